@@ -31,6 +31,7 @@ export const useWindowSize = () => {
   return size;
 };
 
+// The range is start < w <= end, an end of 0 has no upper bound. The server uses the same ranges.
 export const useCurrentBreakpoint = () => {
   const breakpoints = useAppStore((state) => state.config.breakpoints);
   const w = useDebounce(useWindowSize()?.w || 0, 100);
@@ -38,7 +39,7 @@ export const useCurrentBreakpoint = () => {
   for (let i = breakpoints.length - 1; i >= 0; i--) {
     if (w > breakpoints[i]) return { start: breakpoints[i], end: breakpoints[i + 1] || 0 };
   }
-  return { start: 0, end: w };
+  return { start: 0, end: breakpoints[0] };
 };
 
 export const usePinPosition = (p: PinPosition) => {
@@ -70,8 +71,8 @@ export const usePins = () => {
     ? (data?.nodes || []).filter((pin) => {
         if (r.start === 0 && r.end === 0) return true;
         if (r.start === 0 && r.end !== 0) return pin.w <= r.end;
-        if (r.start !== 0 && r.end === 0) return pin.w >= r.start;
-        return pin.w >= r.start && pin.w <= r.end;
+        if (r.start !== 0 && r.end === 0) return pin.w > r.start;
+        return pin.w > r.start && pin.w <= r.end;
       }) // Filter out pins that shouldn't be visible at the current breakpoints
     : [];
 
@@ -152,15 +152,17 @@ describe('/pins/:id', () => {
   });
 
   test('DELETE /complete', async () => {
-    expect(await env.DB.prepare('SELECT completed_at, completed_by_id FROM pins').first()).toEqual({
+    expect(await env.DB.prepare('SELECT status, completed_at, completed_by_id FROM pins').first()).toEqual({
+      status: 'open',
       completed_at: null,
       completed_by_id: null,
     });
 
     // complete
     const res = await app.request('/pins/1/complete', { method: 'POST', body: ' 1 ' }, env);
-    expect(await env.DB.prepare('SELECT completed_at, completed_by_id FROM pins').first()).toEqual(
+    expect(await env.DB.prepare('SELECT status, completed_at, completed_by_id FROM pins').first()).toEqual(
       expect.objectContaining({
+        status: 'resolved',
         completed_at: expect.any(String),
         completed_by_id: 1,
       }),
@@ -170,7 +172,8 @@ describe('/pins/:id', () => {
 
     // uncomplete
     const res2 = await app.request('/pins/1/complete', { method: 'POST', body: ' a ' }, env);
-    expect(await env.DB.prepare('SELECT completed_at, completed_by_id FROM pins').first()).toEqual({
+    expect(await env.DB.prepare('SELECT status, completed_at, completed_by_id FROM pins').first()).toEqual({
+      status: 'open',
       completed_at: null,
       completed_by_id: null,
     });
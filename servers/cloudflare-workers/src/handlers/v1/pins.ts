@@ -92,14 +92,14 @@ pins.post('/:id/complete', async (c) => {
   if ((await c.req.text()).trim() === '1') {
     const stmt = c.env.DB.prepare(`
       UPDATE pins
-      SET completed_at = CURRENT_TIMESTAMP, completed_by_id = ?2
+      SET status = 'resolved', completed_at = CURRENT_TIMESTAMP, completed_by_id = ?2
       WHERE id = ?1 AND completed_at IS NULL
     `);
     await stmt.bind(c.req.param('id'), c.var.userId).run();
   } else {
     const stmt = c.env.DB.prepare(`
       UPDATE pins
-      SET completed_at = NULL, completed_by_id = NULL
+      SET status = 'open', completed_at = NULL, completed_by_id = NULL
       WHERE id = ?1 AND completed_at IS NOT NULL
     `);
     await stmt.bind(c.req.param('id')).run();
@@ -5,4 +5,5 @@ const (
 
 	AppIDKey  = "appId"
 	UserIDKey = "userId"
+	RoleKey   = "role"
 )
@@ -2,28 +2,37 @@ package db
 
 import (
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/XSAM/otelsql"
+	"github.com/brantem/aloy/metrics"
 	"github.com/jmoiron/sqlx"
 	"github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog"
 	sqldblogger "github.com/simukti/sqldb-logger"
 	"github.com/simukti/sqldb-logger/logadapter/zerologadapter"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func New() *sqlx.DB {
-	logger := zerolog.New(os.Stdout)
+//go:generate sh migration.sh
+
+// New opens DB_PATH, queries are logged to w
+func New(w io.Writer) *sqlx.DB {
+	logger := zerolog.New(w)
 	if os.Getenv("DEBUG") != "" {
-		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout})
+		logger = zerolog.New(zerolog.ConsoleWriter{Out: w})
 	}
 
-	path := fmt.Sprintf("%s?_foreign_keys=on", os.Getenv("DB_PATH"))
+	// Writes wait for the lock instead of failing right away with SQLITE_BUSY
+	path := fmt.Sprintf("%s?_foreign_keys=on&_busy_timeout=5000", os.Getenv("DB_PATH"))
 	opts := []sqldblogger.Option{
 		sqldblogger.WithPreparerLevel(sqldblogger.LevelDebug),
 		sqldblogger.WithQueryerLevel(sqldblogger.LevelDebug),
 		sqldblogger.WithExecerLevel(sqldblogger.LevelDebug),
 	}
-	_db := sqldblogger.OpenDriver(path, &sqlite3.SQLiteDriver{}, zerologadapter.New(logger), opts...)
+	driver := otelsql.WrapDriver(&sqlite3.SQLiteDriver{}, otelsql.WithAttributes(semconv.DBSystemSqlite))
+	_db := sqldblogger.OpenDriver(path, driver, metrics.NewDBLogger(zerologadapter.New(logger)), opts...)
 	db := sqlx.NewDb(_db, "sqlite3")
 	return db
 }
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigration(t *testing.T) {
+	entries, err := os.ReadDir("../../migrations")
+	assert.Nil(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".sql") {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+
+	assert.Equal(t, names[len(names)-1], Migration, "run go generate ./db")
+}
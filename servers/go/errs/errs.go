@@ -9,7 +9,9 @@ import (
 var (
 	ErrInternalServerError = NewCodeError("INTERNAL_SERVER_ERROR")
 	ErrNotFound            = NewCodeError("NOT_FOUND")
+	ErrForbidden           = NewCodeError("FORBIDDEN")
 	ErrInvalid             = NewCodeError("INVALID")
+	ErrRateLimited         = NewCodeError("RATE_LIMITED")
 )
 
 type CodeError struct {
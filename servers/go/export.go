@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/brantem/aloy/db"
+	"github.com/brantem/aloy/export"
+)
+
+// runExport is the CLI version of GET /v1/export, it writes to stdout unless -o
+// is set.
+func runExport(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	appID := fs.String("app", "", "app id")
+	output := fs.String("o", "", "output file")
+	var opts export.Options
+	fs.StringVar(&opts.Format, "format", export.FormatJSON, "json or csv")
+	fs.StringVar(&opts.Path, "path", "", "only pins on this path")
+	fs.StringVar(&opts.Status, "status", "", "only pins with this status")
+	fs.StringVar(&opts.From, "from", "", "only pins created on or after this date (YYYY-MM-DD)")
+	fs.StringVar(&opts.To, "to", "", "only pins created on or before this date (YYYY-MM-DD)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *appID == "" {
+		return errors.New("-app is required")
+	}
+	if err := opts.Validate(); err != nil {
+		return errors.New("invalid -format, -from or -to")
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		var f *os.File
+		if f, err = os.Create(*output); err != nil {
+			return err
+		}
+		// The file can still be incomplete when only the close fails
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+
+	// Only the export goes to stdout
+	db := db.New(os.Stderr)
+	defer db.Close()
+
+	rows, err := export.Query(ctx, db, *appID, opts)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := rows.Write(ctx, bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
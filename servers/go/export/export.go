@@ -0,0 +1,262 @@
+// Package export writes the feedback of an app as JSON or CSV, one row per
+// comment, for the people who want it in a spreadsheet.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/settings"
+	"github.com/brantem/aloy/text"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// PageSize is how many rows are read at a time. Nothing is read from the
+// database while a page is written, so a slow download doesn't hold it.
+const PageSize = 500
+
+// Options picks the format and the pins to export. From and To are dates in the
+// YYYY-MM-DD format compared against the day the pin was created, both inclusive.
+type Options struct {
+	Format string
+	Path   string
+	Status string
+	From   string
+	To     string
+}
+
+// Validate returns errs.MapErrors keyed by the query parameter names
+func (o *Options) Validate() error {
+	me := make(errs.MapErrors)
+
+	if o.Format != FormatJSON && o.Format != FormatCSV {
+		me["format"] = errs.ErrInvalid
+	}
+
+	for k, v := range map[string]string{"from": o.From, "to": o.To} {
+		if _, err := time.Parse(time.DateOnly, v); v != "" && err != nil {
+			me[k] = errs.ErrInvalid
+		}
+	}
+
+	if len(me) != 0 {
+		return me
+	}
+	return nil
+}
+
+type Row struct {
+	PinID       int         `json:"pin_id" db:"pin_id"`
+	Path        string      `json:"path" db:"_path"`
+	Status      string      `json:"status"`
+	Environment *string     `json:"environment"`
+	Version     *string     `json:"version"`
+	Screenshot  *string     `json:"screenshot"`
+	CompletedAt *model.Time `json:"completed_at" db:"completed_at"`
+	CommentID   int         `json:"comment_id" db:"comment_id"`
+	UserID      string      `json:"user_id" db:"user_id"`
+	UserName    string      `json:"user_name" db:"user_name"`
+	UserEmail   *string     `json:"user_email" db:"user_email"`
+	Text        string      `json:"text"`
+	// RawAttachments has one url per line
+	RawAttachments *string    `json:"-" db:"attachments"`
+	Attachments    []string   `json:"attachments" db:"-"`
+	CreatedAt      model.Time `json:"created_at" db:"created_at"`
+}
+
+var header = []string{"pin_id", "path", "status", "environment", "version", "screenshot", "completed_at", "comment_id", "user_id", "user_name", "user_email", "text", "attachments", "created_at"}
+
+func (r *Row) record() []string {
+	return []string{
+		strconv.Itoa(r.PinID),
+		cell(r.Path),
+		cell(r.Status),
+		cell(str(r.Environment)),
+		cell(str(r.Version)),
+		cell(str(r.Screenshot)),
+		timestamp(r.CompletedAt),
+		strconv.Itoa(r.CommentID),
+		cell(r.UserID),
+		cell(r.UserName),
+		cell(str(r.UserEmail)),
+		cell(r.Text),
+		cell(strings.Join(r.Attachments, "\n")),
+		timestamp(&r.CreatedAt),
+	}
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// cell keeps spreadsheets from running text written by users as a formula
+func cell(s string) string {
+	if s != "" && strings.IndexByte("=+-@\t\r", s[0]) != -1 {
+		return "'" + s
+	}
+	return s
+}
+
+func timestamp(t *model.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Rows is an export whose first page has been queried but not written yet
+type Rows struct {
+	db    *sqlx.DB
+	appID string
+	opts  Options
+	names map[int]string
+	page  []*Row
+}
+
+// Query selects the comments of the pins that match opts, the path is
+// normalized like the one of the pins. Options has to be validated first.
+func Query(ctx context.Context, db *sqlx.DB, appID string, opts Options) (*Rows, error) {
+	if opts.Path != "" {
+		s, err := settings.Get(ctx, db, appID)
+		if err != nil {
+			return nil, err
+		}
+		opts.Path = s.Paths.Normalize(opts.Path)
+	}
+
+	// Mentions can point to anyone in the app, not only to the authors
+	names := make(map[int]string)
+	users, err := db.QueryxContext(ctx, `SELECT id, name FROM users WHERE app_id = ?`, appID)
+	if err != nil {
+		log.Error().Err(err).Msg("export.Query")
+		return nil, errs.ErrInternalServerError
+	}
+	defer users.Close()
+
+	for users.Next() {
+		var id int
+		var name string
+		if err := users.Scan(&id, &name); err != nil {
+			log.Error().Err(err).Msg("export.Query")
+			return nil, errs.ErrInternalServerError
+		}
+		names[id] = name
+	}
+
+	r := &Rows{db: db, appID: appID, opts: opts, names: names}
+	if r.page, err = r.query(ctx, 0, 0); err != nil {
+		log.Error().Err(err).Msg("export.Query")
+		return nil, errs.ErrInternalServerError
+	}
+
+	return r, nil
+}
+
+// query selects the page of rows after the comment commentID of the pin pinID
+func (r *Rows) query(ctx context.Context, pinID, commentID int) ([]*Row, error) {
+	var rows []*Row
+	err := r.db.SelectContext(ctx, &rows, `
+		SELECT
+		  p.id AS pin_id, p._path, p.status, p.environment, p.version, json_extract(p.screenshot, '$.url') AS screenshot, p.completed_at,
+		  c.id AS comment_id, u._id AS user_id, u.name AS user_name, u.email AS user_email, c.text,
+		  (SELECT GROUP_CONCAT(a.url, char(10)) FROM attachments a WHERE a.comment_id = c.id) AS attachments,
+		  c.created_at
+		FROM pins p
+		JOIN comments c ON c.pin_id = p.id
+		JOIN users u ON u.id = c.user_id
+		WHERE p.app_id = ?
+		  AND CASE WHEN ? != '' THEN p._path = ? ELSE TRUE END
+		  AND CASE WHEN ? != '' THEN p.status = ? ELSE TRUE END
+		  AND CASE WHEN ? != '' THEN p.created_at >= ? ELSE TRUE END
+		  AND CASE WHEN ? != '' THEN p.created_at < date(?, '+1 day') ELSE TRUE END
+		  AND (p.id, c.id) > (?, ?)
+		ORDER BY p.id ASC, c.id ASC
+		LIMIT ?
+	`, r.appID, r.opts.Path, r.opts.Path, r.opts.Status, r.opts.Status, r.opts.From, r.opts.From, r.opts.To, r.opts.To, pinID, commentID, PageSize)
+	return rows, err
+}
+
+// Write streams the rows to w in the format of the options passed to Query,
+// the pages after the first one are queried as it goes
+func (r *Rows) Write(ctx context.Context, w io.Writer) error {
+	var write func(row *Row) error
+	var flush func() error
+
+	switch r.opts.Format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		write = func(row *Row) error { return cw.Write(row.record()) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		first := true
+		write = func(row *Row) error {
+			b, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if !first {
+				b = append([]byte(","), b...)
+			}
+			first = false
+			_, err = w.Write(b)
+			return err
+		}
+		flush = func() error {
+			_, err := io.WriteString(w, "]")
+			return err
+		}
+	}
+
+	for {
+		for _, row := range r.page {
+			row.Text = text.Plain(row.Text, r.names)
+			row.Attachments = []string{}
+			if row.RawAttachments != nil {
+				row.Attachments = strings.Split(*row.RawAttachments, "\n")
+			}
+
+			if err := write(row); err != nil {
+				log.Error().Err(err).Msg("export.Write")
+				return err
+			}
+		}
+		if len(r.page) < PageSize {
+			break
+		}
+
+		last := r.page[len(r.page)-1]
+		page, err := r.query(ctx, last.PinID, last.CommentID)
+		if err != nil {
+			log.Error().Err(err).Msg("export.Write")
+			return err
+		}
+		r.page = page
+	}
+
+	return flush()
+}
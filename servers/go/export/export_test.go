@@ -0,0 +1,107 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := Options{Format: FormatCSV, From: "2024-01-01", To: "2024-01-31"}
+	assert.Nil(opts.Validate())
+
+	opts = Options{Format: "xml", From: "yesterday", To: "2024-01-01"}
+	assert.Equal(errs.MapErrors{"format": errs.ErrInvalid, "from": errs.ErrInvalid}, opts.Validate())
+}
+
+func query(t *testing.T, opts Options) *Rows {
+	db, mock := db.New()
+
+	mock.ExpectQuery("SELECT settings FROM apps").
+		WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"paths":{"trim_trailing_slash":true}}`))
+
+	mock.ExpectQuery("SELECT id, name FROM users").
+		WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1").AddRow(2, "User 2"))
+
+	mock.ExpectQuery("SELECT .+ FROM pins p JOIN comments c .+ ORDER BY p.id ASC, c.id ASC").
+		WithArgs("test", "/about", "/about", "open", "open", "2024-01-01", "2024-01-01", "", "", 0, 0, PageSize).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"pin_id", "_path", "status", "environment", "version", "screenshot", "completed_at", "comment_id", "user_id", "user_name", "user_email", "text", "attachments", "created_at"}).
+				AddRow(1, "/about", "open", "staging", nil, "http://localhost/screenshots/1.png", nil, 1, "a", "User 1", "a@example.com", `[{"type":"paragraph","children":[{"text":"hi "},{"type":"mention","user_id":2,"children":[{"text":""}]}]}]`, "http://localhost/attachments/1.png\nhttp://localhost/attachments/2.png", "2024-01-01 00:00:00").
+				AddRow(1, "/about", "open", "staging", nil, "http://localhost/screenshots/1.png", nil, 2, "b", "User 2", nil, "done, \"really\"", nil, "2024-01-02 00:00:00"),
+		)
+
+	opts.Path = "/about/"
+	opts.Status = "open"
+	opts.From = "2024-01-01"
+
+	rows, err := Query(context.TODO(), db, "test", opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+	return rows
+}
+
+func Test_cell(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []string{"=1+1", "+1", "-1", "@SUM(A1)", "\t=1", "\r=1"} {
+		assert.Equal("'"+s, cell(s))
+	}
+	assert.Equal("", cell(""))
+	assert.Equal("a=1", cell("a=1"))
+}
+
+func TestRows_Write(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		var b strings.Builder
+		assert.Nil(t, query(t, Options{Format: FormatJSON}).Write(context.TODO(), &b))
+		assert.Equal(t, `[{"pin_id":1,"path":"/about","status":"open","environment":"staging","version":null,"screenshot":"http://localhost/screenshots/1.png","completed_at":null,"comment_id":1,"user_id":"a","user_name":"User 1","user_email":"a@example.com","text":"hi @User 2","attachments":["http://localhost/attachments/1.png","http://localhost/attachments/2.png"],"created_at":"2024-01-01T00:00:00Z"},{"pin_id":1,"path":"/about","status":"open","environment":"staging","version":null,"screenshot":"http://localhost/screenshots/1.png","completed_at":null,"comment_id":2,"user_id":"b","user_name":"User 2","user_email":null,"text":"done, \"really\"","attachments":[],"created_at":"2024-01-02T00:00:00Z"}]`, b.String())
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var b strings.Builder
+		assert.Nil(t, query(t, Options{Format: FormatCSV}).Write(context.TODO(), &b))
+		assert.Equal(t, "pin_id,path,status,environment,version,screenshot,completed_at,comment_id,user_id,user_name,user_email,text,attachments,created_at\n"+
+			"1,/about,open,staging,,http://localhost/screenshots/1.png,,1,a,User 1,a@example.com,hi @User 2,\"http://localhost/attachments/1.png\nhttp://localhost/attachments/2.png\",2024-01-01T00:00:00Z\n"+
+			"1,/about,open,staging,,http://localhost/screenshots/1.png,,2,b,User 2,,\"done, \"\"really\"\"\",,2024-01-02T00:00:00Z\n", b.String())
+	})
+}
+
+func TestRows_Write_pages(t *testing.T) {
+	assert := assert.New(t)
+
+	db := db.NewSQLite(t, "../../migrations")
+	db.MustExec(`INSERT INTO users (id, _id, app_id, name) VALUES (1, 'a', 'test', 'User 1')`)
+	db.MustExec(`INSERT INTO pins (id, app_id, user_id, _path, path, w, _x, x, _y, y) VALUES (1, 'test', 1, '/', 'body', 1, 1, 1, 1, 1), (2, 'test', 1, '/', 'body', 1, 1, 1, 1, 1)`)
+	// The first page ends with the last comment of the first pin
+	for i := 1; i <= PageSize; i++ {
+		db.MustExec(`INSERT INTO comments (id, pin_id, user_id, text) VALUES (?, 1, 1, '[]')`, i)
+	}
+	db.MustExec(`INSERT INTO comments (id, pin_id, user_id, text) VALUES (?, 2, 1, '[]')`, PageSize+1)
+
+	rows, err := Query(context.TODO(), db, "test", Options{Format: FormatJSON})
+	assert.Nil(err)
+
+	var b strings.Builder
+	assert.Nil(rows.Write(context.TODO(), &b))
+
+	var v []Row
+	assert.Nil(json.Unmarshal([]byte(b.String()), &v))
+	assert.Len(v, PageSize+1)
+	for i, row := range v {
+		assert.Equal(i+1, row.CommentID)
+	}
+	assert.Equal(2, v[PageSize].PinID)
+}
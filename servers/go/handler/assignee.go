@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/handler/body"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/tracing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+func (h *Handler) getAssignees(ctx context.Context, pinIds []int) (map[int][]*model.User, error) {
+	ctx, span := tracing.Start(ctx, "assignee.getAssignees")
+	defer span.End()
+
+	if len(pinIds) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT a.pin_id, u.id, u.name, u.avatar_url, u.metadata
+		FROM pin_assignees a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.pin_id IN (?)
+		ORDER BY a.created_at ASC
+	`, pinIds)
+	if err != nil {
+		log.Error().Err(err).Msg("assignee.getAssignees")
+		return nil, errs.ErrInternalServerError
+	}
+
+	rows, err := h.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("assignee.getAssignees")
+		return nil, errs.ErrInternalServerError
+	}
+	defer rows.Close()
+
+	m := make(map[int][]*model.User, len(pinIds))
+	for rows.Next() {
+		var node struct {
+			PinID int `db:"pin_id"`
+			model.User
+		}
+		if err := rows.StructScan(&node); err != nil {
+			log.Error().Err(err).Msg("assignee.getAssignees")
+			return nil, errs.ErrInternalServerError
+		}
+		m[node.PinID] = append(m[node.PinID], &node.User)
+	}
+
+	return m, nil
+}
+
+func (h *Handler) assignPin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	r := role(c)
+	if !policy.Can(r, policy.AssignPin) && !policy.Can(r, policy.AssignAnyPin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	var data struct {
+		UserID int `json:"user_id" validate:"required"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	userID := c.Locals(constant.UserIDKey)
+
+	// The no-op update makes assigning someone twice count as a change, so no rows
+	// means the pin or the user doesn't exist in this app
+	res, err := h.db.ExecContext(c.UserContext(), `
+		INSERT INTO pin_assignees (pin_id, user_id, assigned_by_id)
+		SELECT p.id, u.id, ?
+		FROM pins p
+		JOIN users u ON u.app_id = p.app_id
+		WHERE p.id = ?
+		  AND p.app_id = ?
+		  AND u.id = ?
+		  AND CASE WHEN ? THEN TRUE ELSE p.user_id = ? END
+		ON CONFLICT (pin_id, user_id) DO UPDATE SET pin_id = EXCLUDED.pin_id
+	`, userID, c.Params("pinId"), c.Locals(constant.AppIDKey), data.UserID, policy.Can(r, policy.AssignAnyPin), userID)
+	if err != nil {
+		log.Error().Err(err).Msg("assignee.assignPin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) unassignPin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	r := role(c)
+	if !policy.Can(r, policy.AssignPin) && !policy.Can(r, policy.AssignAnyPin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	userID := c.Locals(constant.UserIDKey)
+
+	// Assignees can always take themselves off a pin
+	_, err := h.db.ExecContext(c.UserContext(), `
+		DELETE FROM pin_assignees
+		WHERE pin_id = ?
+		  AND user_id = ?
+		  AND pin_id IN (
+		    SELECT id
+		    FROM pins
+		    WHERE app_id = ?
+		      AND CASE WHEN ? OR ? = ? THEN TRUE ELSE user_id = ? END
+		  )
+	`, c.Params("pinId"), c.Params("userId"), c.Locals(constant.AppIDKey), policy.Can(r, policy.AssignAnyPin), c.Params("userId"), userID, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("assignee.unassignPin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
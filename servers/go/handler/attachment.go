@@ -9,14 +9,18 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"math/rand/v2"
 	"mime/multipart"
 	"path/filepath"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/metrics"
 	"github.com/brantem/aloy/model"
 	"github.com/brantem/aloy/storage"
+	"github.com/brantem/aloy/tracing"
 	"github.com/galdor/go-thumbhash"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
@@ -70,49 +74,114 @@ func (h *Handler) uploadAttachments(c *fiber.Ctx) ([]*UploadAttachmentResult, er
 
 	results := make([]*UploadAttachmentResult, 0, len(m))
 	for key, fh := range m {
-		_type := fh.Header.Get("Content-Type")
-
-		file, err := fh.Open()
+		result, err := h.uploadImage(c.UserContext(), "attachments", fh)
 		if err != nil {
 			log.Error().Err(err).Str("key", key).Msg("attachment.uploadAttachments")
+			h.deleteUploads(c.UserContext(), results)
 			return nil, errs.ErrInternalServerError
 		}
+		metrics.AttachmentSize.Observe(float64(fh.Size))
+		results = append(results, result)
+	}
 
-		img, _, err := image.Decode(file)
-		if err != nil {
-			log.Error().Err(err).Str("key", key).Msg("attachment.uploadAttachments")
-			return nil, errs.ErrInternalServerError
-		}
+	return results, nil
+}
 
-		if _, err := file.Seek(0, io.SeekStart); err != nil {
-			log.Error().Err(err).Msg("attachment.uploadAttachments")
-			return nil, errs.ErrInternalServerError
-		}
+// screenshotFile returns the screenshot of a new pin, which is optional, once
+// it's known to be valid. It's checked before anything is uploaded.
+func (h *Handler) screenshotFile(c *fiber.Ctx) (*multipart.FileHeader, error) {
+	fh, err := c.FormFile("screenshot")
+	if err != nil {
+		return nil, nil
+	}
 
-		opts := &storage.UploadOpts{
-			Key:           fmt.Sprintf("attachments/%d%s", time.Now().Unix()*1000, filepath.Ext(fh.Filename)),
-			Body:          file,
-			ContentType:   _type,
-			ContentLength: fh.Size,
-		}
-		if err := h.storage.Upload(c.UserContext(), opts); err != nil {
-			log.Error().Err(err).Str("key", key).Msg("attachment.uploadAttachments")
-			return nil, errs.ErrInternalServerError
-		}
+	if fh.Size > int64(h.config.screenshotMaxSize) {
+		return nil, errs.MapErrors{"screenshot": errs.NewCodeError("TOO_BIG")}
+	}
 
-		results = append(results, &UploadAttachmentResult{
-			URL: fmt.Sprintf("%s/%s", h.config.assetsBaseURL, opts.Key),
-			Data: map[string]string{
-				"type": _type,
-				"hash": base64.StdEncoding.EncodeToString(thumbhash.EncodeImage(img)),
-			},
-		})
+	if !slices.Contains(h.config.attachmentSupportedTypes, fh.Header.Get("Content-Type")) {
+		return nil, errs.MapErrors{"screenshot": errs.NewCodeError("UNSUPPORTED")}
 	}
 
-	return results, nil
+	return fh, nil
+}
+
+// uploadScreenshot uploads the file returned by screenshotFile
+func (h *Handler) uploadScreenshot(ctx context.Context, fh *multipart.FileHeader) (*UploadAttachmentResult, error) {
+	if fh == nil {
+		return nil, nil
+	}
+
+	result, err := h.uploadImage(ctx, "screenshots", fh)
+	if err != nil {
+		log.Error().Err(err).Msg("attachment.uploadScreenshot")
+		return nil, errs.ErrInternalServerError
+	}
+
+	return result, nil
+}
+
+// uploadImage uploads an image to dir in the storage, along with its thumbhash
+func (h *Handler) uploadImage(ctx context.Context, dir string, fh *multipart.FileHeader) (*UploadAttachmentResult, error) {
+	_type := fh.Header.Get("Content-Type")
+
+	file, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	opts := &storage.UploadOpts{
+		// The suffix keeps uploads in the same millisecond apart
+		Key:           fmt.Sprintf("%s/%d-%08x%s", dir, time.Now().UnixMilli(), rand.Uint32(), filepath.Ext(fh.Filename)),
+		Body:          file,
+		ContentType:   _type,
+		ContentLength: fh.Size,
+	}
+	if err := h.storage.Upload(ctx, opts); err != nil {
+		return nil, err
+	}
+
+	return &UploadAttachmentResult{
+		URL: fmt.Sprintf("%s/%s", h.config.assetsBaseURL, opts.Key),
+		Data: map[string]string{
+			"type": _type,
+			"hash": base64.StdEncoding.EncodeToString(thumbhash.EncodeImage(img)),
+		},
+	}, nil
+}
+
+// deleteUploads deletes the files of results that nothing points to, like when
+// saving what they belong to fails
+func (h *Handler) deleteUploads(ctx context.Context, results []*UploadAttachmentResult) {
+	keys := make([]string, 0, len(results))
+	for _, result := range results {
+		if key, ok := strings.CutPrefix(result.URL, h.config.assetsBaseURL+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := h.storage.DeleteMultiple(ctx, keys); err != nil {
+		log.Error().Err(err).Msg("attachment.deleteUploads")
+	}
 }
 
 func (h *Handler) getAttachments(ctx context.Context, commentIds []int) (map[int][]*model.Attachment, error) {
+	ctx, span := tracing.Start(ctx, "attachment.getAttachments")
+	defer span.End()
+
 	if len(commentIds) == 0 {
 		return nil, nil
 	}
@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/errs"
 	"github.com/brantem/aloy/testutil"
 	"github.com/brantem/aloy/testutil/db"
 	"github.com/brantem/aloy/testutil/storage"
@@ -197,11 +198,86 @@ func Test_uploadAttachments(t *testing.T) {
 
 		app.Test(req)
 		assert.Equal(1, storage.UploadN)
-		assert.Regexp(`attachments/\d+\.png`, storage.UploadOpts[0].Key)
+		assert.Regexp(`^attachments/\d+-[0-9a-f]{8}\.png$`, storage.UploadOpts[0].Key)
 		assert.Equal("image/png", storage.UploadOpts[0].ContentType)
 	})
 }
 
+func Test_uploadScreenshot(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("ASSETS_BASE_URL", "https://assets.aloy.com")
+	t.Setenv("ATTACHMENT_SUPPORTED_TYPES", "image/png")
+	t.Setenv("SCREENSHOT_MAX_SIZE", "200b")
+
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	hash := base64.StdEncoding.EncodeToString(thumbhash.EncodeImage(img))
+
+	upload := func(h *Handler, write func(writer *multipart.Writer)) (result *UploadAttachmentResult, err error) {
+		app := fiber.New()
+		app.Post("/", func(c *fiber.Ctx) error {
+			var fh *multipart.FileHeader
+			if fh, err = h.screenshotFile(c); err == nil {
+				result, err = h.uploadScreenshot(c.UserContext(), fh)
+			}
+			return nil
+		})
+
+		buf := &bytes.Buffer{}
+		writer := multipart.NewWriter(buf)
+		write(writer)
+		writer.Close()
+
+		req := httptest.NewRequest(fiber.MethodPost, "/", buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		app.Test(req)
+		return
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		result, err := upload(New(nil, storage.New()), func(writer *multipart.Writer) {})
+		assert.Nil(result)
+		assert.Nil(err)
+	})
+
+	t.Run("TOO_BIG", func(t *testing.T) {
+		// Bigger than SCREENSHOT_MAX_SIZE but within the default ATTACHMENT_MAX_SIZE
+		result, err := upload(New(nil, storage.New()), func(writer *multipart.Writer) {
+			screenshot := testutil.CreateFormFile(writer, "screenshot", "a.png", "image/png")
+			screenshot.Write(bytes.Repeat([]byte("a"), 300))
+		})
+		assert.Nil(result)
+		assert.Equal(errs.MapErrors{"screenshot": errs.NewCodeError("TOO_BIG")}, err)
+	})
+
+	t.Run("UNSUPPORTED", func(t *testing.T) {
+		result, err := upload(New(nil, storage.New()), func(writer *multipart.Writer) {
+			screenshot := testutil.CreateFormFile(writer, "screenshot", "a.txt", "text/plain")
+			screenshot.Write([]byte("a"))
+		})
+		assert.Nil(result)
+		assert.Equal(errs.MapErrors{"screenshot": errs.NewCodeError("UNSUPPORTED")}, err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		storage := storage.New()
+		h := New(nil, storage)
+
+		result, err := upload(h, func(writer *multipart.Writer) {
+			screenshot := testutil.CreateFormFile(writer, "screenshot", "a.png", "image/png")
+			png.Encode(screenshot, img)
+		})
+		assert.Nil(err)
+		assert.Equal(1, storage.UploadN)
+		assert.Regexp(`^screenshots/\d+-[0-9a-f]{8}\.png$`, storage.UploadOpts[0].Key)
+		assert.Equal(&UploadAttachmentResult{
+			URL:  fmt.Sprintf("%s/%s", h.config.assetsBaseURL, storage.UploadOpts[0].Key),
+			Data: map[string]string{"hash": hash, "type": "image/png"},
+		}, result)
+	})
+}
+
 func Test_getAttachments(t *testing.T) {
 	assert := assert.New(t)
 
@@ -8,12 +8,17 @@ import (
 	"github.com/brantem/aloy/errs"
 	"github.com/brantem/aloy/handler/body"
 	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/tracing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
 )
 
 func (h *Handler) getComments(ctx context.Context, commentIds []int) (map[int]*model.Comment, error) {
+	ctx, span := tracing.Start(ctx, "comment.getComments")
+	defer span.End()
+
 	if len(commentIds) == 0 {
 		return nil, nil
 	}
@@ -54,6 +59,11 @@ func (h *Handler) updateComment(c *fiber.Ctx) error {
 		Error   any  `json:"error"`
 	}
 
+	if !policy.Can(role(c), policy.UpdateComment) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
 	var data struct {
 		Text string `json:"text" validate:"trim,required"`
 	}
@@ -64,9 +74,9 @@ func (h *Handler) updateComment(c *fiber.Ctx) error {
 
 	_, err := h.db.ExecContext(c.UserContext(), `
 		UPDATE comments
-		SET text = 3
-		WHERE id = 1
-		  AND user_id = 2
+		SET text = ?
+		WHERE id = ?
+		  AND user_id = ?
 	`, data.Text, c.Params("commentId"), c.Locals(constant.UserIDKey))
 	if err != nil {
 		log.Error().Err(err).Msg("comment.updateComment")
@@ -84,9 +94,15 @@ func (h *Handler) deleteComment(c *fiber.Ctx) error {
 		Error   any  `json:"error"`
 	}
 
+	r := role(c)
+	if !policy.Can(r, policy.DeleteComment) && !policy.Can(r, policy.DeleteAnyComment) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
 	commentID, _ := c.ParamsInt("commentId")
 
-	rows, err := h.db.QueryContext(c.UserContext(), `SELECT url FROM attachments WHERE id = ?`, commentID)
+	rows, err := h.db.QueryContext(c.UserContext(), `SELECT url FROM attachments WHERE comment_id = ?`, commentID)
 	if err != nil {
 		log.Error().Err(err).Msg("comment.deleteComment")
 		result.Error = errs.ErrInternalServerError
@@ -105,18 +121,20 @@ func (h *Handler) deleteComment(c *fiber.Ctx) error {
 		keys = append(keys, strings.TrimPrefix(url, h.config.assetsBaseURL+"/"))
 	}
 
-	_, err = h.db.ExecContext(c.UserContext(), `
+	res, err := h.db.ExecContext(c.UserContext(), `
 		DELETE FROM comments
 		WHERE id = ?
-		  AND user_id = ?
-	`, commentID, c.Locals(constant.UserIDKey))
+		  AND pin_id IN (SELECT id FROM pins WHERE app_id = ?)
+		  AND CASE WHEN ? THEN TRUE ELSE user_id = ? END
+	`, commentID, c.Locals(constant.AppIDKey), policy.Can(r, policy.DeleteAnyComment), c.Locals(constant.UserIDKey))
 	if err != nil {
 		log.Error().Err(err).Msg("comment.deleteComment")
 		result.Error = errs.ErrInternalServerError
 		return c.Status(fiber.StatusInternalServerError).JSON(result)
 	}
 
-	if len(keys) > 0 {
+	// The attachments are only removed when the comment was actually deleted
+	if n, _ := res.RowsAffected(); n > 0 && len(keys) > 0 {
 		h.storage.DeleteMultiple(c.UserContext(), keys)
 	}
 
@@ -75,7 +75,7 @@ func Test_deleteComment(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"url"}).AddRow("https://assets.aloy.com/attachments/a.png"))
 
 	mock.ExpectExec("DELETE FROM comments").
-		WithArgs(1, m.UserIDValue).
+		WithArgs(1, m.AppIDValue, false, m.UserIDValue).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	app := fiber.New()
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/settings"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// appConfig returns what the widget needs to match the server, so it doesn't have
+// to be configured twice. The fields are named after the widget's Config.
+func (h *Handler) appConfig(c *fiber.Ctx) error {
+	type Attachment struct {
+		MaxCount       int      `json:"maxCount"`
+		MaxSize        int      `json:"maxSize"`
+		SupportedTypes []string `json:"supportedTypes"`
+	}
+
+	type Screenshot struct {
+		MaxSize int `json:"maxSize"`
+	}
+
+	type Features struct {
+		Notifications bool `json:"notifications"`
+	}
+
+	type Config struct {
+		Breakpoints []int               `json:"breakpoints"`
+		Attachment  Attachment          `json:"attachment"`
+		Screenshot  Screenshot          `json:"screenshot"`
+		Features    Features            `json:"features"`
+		Statuses    []*model.Status     `json:"statuses"`
+		Transitions map[string][]string `json:"transitions"`
+		Labels      []*model.Label      `json:"labels"`
+	}
+
+	var result struct {
+		Config *Config `json:"config"`
+		Error  any     `json:"error"`
+	}
+
+	appID := c.Locals(constant.AppIDKey).(string)
+
+	s, err := settings.Get(c.UserContext(), h.db, appID)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Config = &Config{
+		Breakpoints: s.Breakpoints,
+		Attachment: Attachment{
+			MaxCount:       h.config.attachmentMaxCount,
+			MaxSize:        h.config.attachmentMaxSize,
+			SupportedTypes: h.config.attachmentSupportedTypes,
+		},
+		Screenshot:  Screenshot{h.config.screenshotMaxSize},
+		Features:    Features{h.config.notifications},
+		Statuses:    s.Statuses,
+		Transitions: s.Transitions,
+		Labels:      []*model.Label{},
+	}
+
+	err = h.db.SelectContext(c.UserContext(), &result.Config.Labels, `
+		SELECT id, name, color
+		FROM labels
+		WHERE app_id = ?
+		ORDER BY name ASC
+	`, appID)
+	if err != nil {
+		log.Error().Err(err).Msg("config.appConfig")
+		result.Config = nil
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_appConfig(t *testing.T) {
+	t.Setenv("ATTACHMENT_MAX_COUNT", "2")
+	t.Setenv("ATTACHMENT_MAX_SIZE", "200kb")
+	t.Setenv("ATTACHMENT_SUPPORTED_TYPES", "image/png")
+	t.Setenv("SCREENSHOT_MAX_SIZE", "2mb")
+	t.Setenv("SMTP_ADDR", "")
+
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+
+	mock.ExpectQuery("SELECT settings FROM apps").
+		WithArgs(m.AppIDValue).
+		WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"statuses":[{"key":"new","name":"New"},{"key":"done","name":"Done","closed":true}],"transitions":{"new":["done"]},"breakpoints":[640,1024]}`))
+
+	mock.ExpectQuery("SELECT id, name, color FROM labels").
+		WithArgs(m.AppIDValue).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "color"}).AddRow(1, "bug", "#ff0000"))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/v1/config", nil)
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"config":{"breakpoints":[640,1024],"attachment":{"maxCount":2,"maxSize":200000,"supportedTypes":["image/png"]},"screenshot":{"maxSize":2000000},"features":{"notifications":false},"statuses":[{"key":"new","name":"New","closed":false},{"key":"done","name":"Done","closed":true}],"transitions":{"new":["done"]},"labels":[{"id":1,"name":"bug","color":"#ff0000"}]},"error":null}`, string(body))
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/export"
+	"github.com/brantem/aloy/policy"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) export(c *fiber.Ctx) error {
+	var result struct {
+		Error any `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.ExportPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	opts := export.Options{
+		Format: c.Query("format", export.FormatJSON),
+		Path:   c.Query("_path"),
+		Status: c.Query("status"),
+		From:   c.Query("from"),
+		To:     c.Query("to"),
+	}
+	if err := opts.Validate(); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	appID := c.Locals(constant.AppIDKey).(string)
+
+	rows, err := export.Query(c.UserContext(), h.db, appID, opts)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if opts.Format == export.FormatCSV {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, appID, opts.Format))
+
+	// The status is already sent by the time the rows are written, so a failure
+	// is passed to the reader instead, which aborts the response before its last
+	// chunk. It's logged by Write.
+	ctx := c.UserContext()
+	pr, pw := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(pw)
+		err := rows.Write(ctx, w)
+		if err == nil {
+			err = w.Flush()
+		}
+		pw.CloseWithError(err)
+	}()
+	c.Context().SetBodyStream(pr, -1)
+
+	return nil
+}
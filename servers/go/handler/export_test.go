@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/export"
+	"github.com/brantem/aloy/testutil"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_export(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/export", nil)
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("INVALID", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/export?format=xlsx&to=2024-13-01", nil)
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"error":{"format":"INVALID","to":"INVALID"}}`, string(body))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		mock.ExpectQuery("SELECT id, name FROM users").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1"))
+
+		mock.ExpectQuery("SELECT .+ FROM pins p JOIN comments c").
+			WithArgs(m.AppIDValue, "", "", "resolved", "resolved", "", "", "2024-01-31", "2024-01-31", 0, 0, export.PageSize).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"pin_id", "_path", "status", "environment", "version", "screenshot", "completed_at", "comment_id", "user_id", "user_name", "user_email", "text", "attachments", "created_at"}).
+					AddRow(1, "/", "resolved", nil, nil, nil, "2024-01-02 00:00:00", 1, "a", "User 1", nil, "hello", nil, "2024-01-01 00:00:00"),
+			)
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/export?format=csv&status=resolved&to=2024-01-31", nil)
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		assert.Equal("text/csv; charset=utf-8", resp.Header.Get(fiber.HeaderContentType))
+		assert.Equal(`attachment; filename="test.csv"`, resp.Header.Get(fiber.HeaderContentDisposition))
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal("pin_id,path,status,environment,version,screenshot,completed_at,comment_id,user_id,user_name,user_email,text,attachments,created_at\n"+
+			"1,/,resolved,,,,2024-01-02T00:00:00Z,1,a,User 1,,hello,,2024-01-01T00:00:00Z\n", string(body))
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		mock.ExpectQuery("SELECT id, name FROM users").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+		// A full first page, so the next one is queried while writing
+		rows := sqlmock.NewRows([]string{"pin_id", "_path", "status", "environment", "version", "screenshot", "completed_at", "comment_id", "user_id", "user_name", "user_email", "text", "attachments", "created_at"})
+		for i := 1; i <= export.PageSize; i++ {
+			rows.AddRow(1, "/", "open", nil, nil, nil, nil, i, "a", "User 1", nil, "hello", nil, "2024-01-01 00:00:00")
+		}
+		mock.ExpectQuery("SELECT .+ FROM pins p JOIN comments c").
+			WillReturnRows(rows)
+
+		mock.ExpectQuery("SELECT .+ FROM pins p JOIN comments c").
+			WithArgs(m.AppIDValue, "", "", "", "", "", "", "", "", 1, export.PageSize, export.PageSize).
+			WillReturnError(errors.New("a"))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/export", nil)
+		// The connection is aborted instead of ending the body like a complete export
+		_, err := app.Test(req)
+		assert.EqualError(err, "a")
+		assert.Nil(mock.ExpectationsWereMet())
+	})
+}
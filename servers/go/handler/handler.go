@@ -5,7 +5,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/brantem/aloy/constant"
 	"github.com/brantem/aloy/middleware"
+	"github.com/brantem/aloy/policy"
 	"github.com/brantem/aloy/storage"
 	"github.com/brantem/aloy/util"
 	"github.com/gofiber/fiber/v2"
@@ -14,11 +16,16 @@ import (
 )
 
 type config struct {
+	adminToken    string
 	assetsBaseURL string
 
 	attachmentMaxCount       int
 	attachmentMaxSize        int
 	attachmentSupportedTypes []string
+
+	screenshotMaxSize int
+
+	notifications bool
 }
 
 type Handler struct {
@@ -36,37 +43,88 @@ func New(db *sqlx.DB, storage storage.StorageInterface) *Handler {
 		storage: storage,
 
 		config: config{
+			adminToken:    os.Getenv("ADMIN_TOKEN"),
 			assetsBaseURL: os.Getenv("ASSETS_BASE_URL"),
 
 			attachmentMaxCount:       attachmentMaxCount,
 			attachmentMaxSize:        utils.ConvertToBytes(util.Getenv("ATTACHMENT_MAX_SIZE", "100kb")),
 			attachmentSupportedTypes: strings.Split(util.Getenv("ATTACHMENT_SUPPORTED_TYPES", "image/gif,image/jpeg,image/png,image/webp"), ","),
+
+			screenshotMaxSize: utils.ConvertToBytes(util.Getenv("SCREENSHOT_MAX_SIZE", "1mb")),
+
+			notifications: os.Getenv("SMTP_ADDR") != "",
 		},
 	}
 }
 
 func (h *Handler) Register(r *fiber.App, m middleware.MiddlewareInterface) {
-	v1 := r.Group("/v1", m.App)
+	v1 := r.Group("/v1", m.App, m.Limit(middleware.LimitApp))
+
+	writes := m.Limit(middleware.LimitWrites)
+
+	v1.Get("/config", h.appConfig)
+	v1.Get("/settings", m.User, h.settings)
+	v1.Patch("/settings", m.User, writes, h.updateSettings)
+
+	uploads := m.Limit(middleware.LimitUploads)
+
+	v1.Post("/users\\:batch", m.Limit(middleware.LimitUsers), h.createUsers)
 
 	users := v1.Group("/users")
-	users.Post("/", h.createUser)
+	users.Get("/", m.User, h.users)
+	users.Post("/", m.Limit(middleware.LimitUsers), h.createUser)
+	users.Get("/me", m.User, h.me)
+	users.Put("/me/notifications", m.User, writes, h.updateNotifications)
+	users.Put("/me/avatar", m.User, writes, uploads, h.updateAvatar)
+	users.Put("/:userId<int>/role", m.User, writes, h.updateUserRole)
+
+	v1.Get("/export", m.User, h.export)
+
+	v1.Get("/pages", m.User, h.pages)
+	v1.Post("/pages/rename", m.User, writes, h.renamePage)
+	v1.Post("/pages/normalize", m.User, writes, h.normalizePages)
 
 	pins := v1.Group("/pins", m.User)
 	{
 		pins.Get("/", h.pins)
-		pins.Post("/", h.createPin)
+		pins.Post("/", writes, uploads, h.createPin)
 
 		pinID := pins.Group("/:pinId<int>")
-		pinID.Post("/complete", h.completePin)
-		pinID.Delete("/", h.deletePin)
+		pinID.Post("/complete", writes, h.completePin)
+		pinID.Post("/read", writes, h.readPin)
+		pinID.Put("/subscription", writes, h.subscribePin)
+		pinID.Delete("/subscription", writes, h.unsubscribePin)
+		pinID.Get("/statuses", h.pinStatuses)
+		pinID.Patch("/status", writes, h.updatePinStatus)
+		pinID.Get("/positions", h.pinPositions)
+		pinID.Patch("/position", writes, h.updatePinPosition)
+		pinID.Put("/detached", writes, h.detachPin)
+		pinID.Delete("/detached", writes, h.attachPin)
+		pinID.Post("/assignees", writes, h.assignPin)
+		pinID.Delete("/assignees/:userId<int>", writes, h.unassignPin)
+		pinID.Put("/labels/:labelId<int>", writes, h.labelPin)
+		pinID.Delete("/labels/:labelId<int>", writes, h.unlabelPin)
+		pinID.Delete("/", writes, h.deletePin)
 
 		comments := pinID.Group("/comments")
 		comments.Get("/", h.pinComments)
-		comments.Post("/", h.createComment)
+		comments.Post("/", writes, uploads, h.createComment)
 	}
 
+	labels := v1.Group("/labels", m.User)
+	labels.Get("/", h.labels)
+	labels.Post("/", writes, h.createLabel)
+	labels.Patch("/:labelId<int>", writes, h.updateLabel)
+	labels.Delete("/:labelId<int>", writes, h.deleteLabel)
+
 	commentID := v1.Group("/comments/:commentId<int>", m.User)
-	commentID.Patch("/", h.updateComment)
-	commentID.Delete("/", h.deleteComment)
+	commentID.Patch("/", writes, h.updateComment)
+	commentID.Delete("/", writes, h.deleteComment)
+	commentID.Post("/reactions", writes, h.createReaction)
+	commentID.Delete("/reactions", writes, h.deleteReaction)
+}
 
+func role(c *fiber.Ctx) policy.Role {
+	v, _ := c.Locals(constant.RoleKey).(string)
+	return policy.Role(v)
 }
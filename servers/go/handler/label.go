@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/handler/body"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/tracing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrLabelTaken = errs.NewCodeError("TAKEN")
+
+func (h *Handler) getLabels(ctx context.Context, pinIds []int) (map[int][]*model.Label, error) {
+	ctx, span := tracing.Start(ctx, "label.getLabels")
+	defer span.End()
+
+	if len(pinIds) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT pl.pin_id, l.id, l.name, l.color
+		FROM pin_labels pl
+		JOIN labels l ON l.id = pl.label_id
+		WHERE pl.pin_id IN (?)
+		ORDER BY l.name ASC
+	`, pinIds)
+	if err != nil {
+		log.Error().Err(err).Msg("label.getLabels")
+		return nil, errs.ErrInternalServerError
+	}
+
+	rows, err := h.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("label.getLabels")
+		return nil, errs.ErrInternalServerError
+	}
+	defer rows.Close()
+
+	m := make(map[int][]*model.Label, len(pinIds))
+	for rows.Next() {
+		var node struct {
+			PinID int `db:"pin_id"`
+			model.Label
+		}
+		if err := rows.StructScan(&node); err != nil {
+			log.Error().Err(err).Msg("label.getLabels")
+			return nil, errs.ErrInternalServerError
+		}
+		m[node.PinID] = append(m[node.PinID], &node.Label)
+	}
+
+	return m, nil
+}
+
+func (h *Handler) labels(c *fiber.Ctx) error {
+	var result struct {
+		Nodes []*model.Label `json:"nodes"`
+		Error any            `json:"error"`
+	}
+	result.Nodes = []*model.Label{}
+
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	err := h.db.SelectContext(c.UserContext(), &result.Nodes, `
+		SELECT id, name, color
+		FROM labels
+		WHERE app_id = ?
+		ORDER BY name ASC
+	`, c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("label.labels")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	c.Set("X-Total-Count", strconv.Itoa(len(result.Nodes)))
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) createLabel(c *fiber.Ctx) error {
+	type Label struct {
+		ID int `json:"id"`
+	}
+
+	var result struct {
+		Label *Label `json:"label"`
+		Error any    `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.ManageLabels) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	var data struct {
+		Name  string `json:"name" validate:"trim,required,max=32"`
+		Color string `json:"color" validate:"trim,required,hexcolor"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	var label Label
+	err := h.db.QueryRowContext(c.UserContext(), `
+		INSERT INTO labels (app_id, name, color)
+		VALUES (?, ?, ?)
+		ON CONFLICT (app_id, name) DO NOTHING
+		RETURNING id
+	`, c.Locals(constant.AppIDKey), data.Name, data.Color).Scan(&label.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			result.Error = errs.MapErrors{"name": ErrLabelTaken}
+			return c.Status(fiber.StatusBadRequest).JSON(result)
+		}
+		log.Error().Err(err).Msg("label.createLabel")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	result.Label = &label
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) updateLabel(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.ManageLabels) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	var data struct {
+		Name  string `json:"name" validate:"trim,omitempty,max=32"`
+		Color string `json:"color" validate:"trim,omitempty,hexcolor"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	var id int
+	err := h.db.QueryRowContext(c.UserContext(), `
+		UPDATE OR IGNORE labels
+		SET name = COALESCE(NULLIF(?, ''), name),
+		    color = COALESCE(NULLIF(?, ''), color)
+		WHERE id = ?
+		  AND app_id = ?
+		RETURNING id
+	`, data.Name, data.Color, c.Params("labelId"), c.Locals(constant.AppIDKey)).Scan(&id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Error().Err(err).Msg("label.updateLabel")
+			result.Error = errs.ErrInternalServerError
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+
+		// OR IGNORE skips the update when the name is taken by another label
+		var exists bool
+		err := h.db.QueryRowContext(c.UserContext(), `
+			SELECT EXISTS (SELECT 1 FROM labels WHERE id = ? AND app_id = ?)
+		`, c.Params("labelId"), c.Locals(constant.AppIDKey)).Scan(&exists)
+		if err != nil {
+			log.Error().Err(err).Msg("label.updateLabel")
+			result.Error = errs.ErrInternalServerError
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+
+		if exists {
+			result.Error = errs.MapErrors{"name": ErrLabelTaken}
+			return c.Status(fiber.StatusBadRequest).JSON(result)
+		}
+
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) deleteLabel(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.ManageLabels) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	_, err := h.db.ExecContext(c.UserContext(), `
+		DELETE FROM labels
+		WHERE id = ?
+		  AND app_id = ?
+	`, c.Params("labelId"), c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("label.deleteLabel")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) labelPin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	r := role(c)
+	if !policy.Can(r, policy.LabelPin) && !policy.Can(r, policy.LabelAnyPin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	// See assignPin for the no-op update
+	res, err := h.db.ExecContext(c.UserContext(), `
+		INSERT INTO pin_labels (pin_id, label_id)
+		SELECT p.id, l.id
+		FROM pins p
+		JOIN labels l ON l.app_id = p.app_id
+		WHERE p.id = ?
+		  AND p.app_id = ?
+		  AND l.id = ?
+		  AND CASE WHEN ? THEN TRUE ELSE p.user_id = ? END
+		ON CONFLICT (pin_id, label_id) DO UPDATE SET pin_id = EXCLUDED.pin_id
+	`, c.Params("pinId"), c.Locals(constant.AppIDKey), c.Params("labelId"), policy.Can(r, policy.LabelAnyPin), c.Locals(constant.UserIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("label.labelPin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) unlabelPin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	r := role(c)
+	if !policy.Can(r, policy.LabelPin) && !policy.Can(r, policy.LabelAnyPin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	_, err := h.db.ExecContext(c.UserContext(), `
+		DELETE FROM pin_labels
+		WHERE pin_id = ?
+		  AND label_id = ?
+		  AND pin_id IN (
+		    SELECT id
+		    FROM pins
+		    WHERE app_id = ?
+		      AND CASE WHEN ? THEN TRUE ELSE user_id = ? END
+		  )
+	`, c.Params("pinId"), c.Params("labelId"), c.Locals(constant.AppIDKey), policy.Can(r, policy.LabelAnyPin), c.Locals(constant.UserIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("label.unlabelPin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_labels(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+
+	mock.ExpectQuery("SELECT .+ FROM labels").
+		WithArgs(m.AppIDValue).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "color"}).AddRow(1, "Bug", "#ff0000"))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/v1/labels", nil)
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Total-Count"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"nodes":[{"id":1,"name":"Bug","color":"#ff0000"}],"error":null}`, string(body))
+}
+
+func Test_createLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		mock.ExpectQuery("INSERT INTO labels").
+			WithArgs(m.AppIDValue, "Bug", "#ff0000").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/labels", strings.NewReader(`{"name":" Bug ","color":"#ff0000"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"label":{"id":1},"error":null}`, string(body))
+	})
+
+	t.Run("TAKEN", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		mock.ExpectQuery("INSERT INTO labels").
+			WithArgs(m.AppIDValue, "Bug", "#ff0000").
+			WillReturnRows(&sqlmock.Rows{})
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/labels", strings.NewReader(`{"name":"Bug","color":"#ff0000"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"label":null,"error":{"name":"TAKEN"}}`, string(body))
+	})
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/labels", strings.NewReader(`{"name":"Bug","color":"#ff0000"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func Test_updateLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		mock.ExpectQuery("UPDATE OR IGNORE labels").
+			WithArgs("", "#00ff00", "1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/labels/1", strings.NewReader(`{"color":"#00ff00"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+
+	t.Run("NOT_FOUND", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		mock.ExpectQuery("UPDATE OR IGNORE labels").
+			WithArgs("Copy", "", "1", m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/labels/1", strings.NewReader(`{"name":"Copy"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("INTERNAL_SERVER_ERROR", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		mock.ExpectQuery("UPDATE OR IGNORE labels").
+			WithArgs("Copy", "", "1", m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("1", m.AppIDValue).
+			WillReturnError(errors.New("database is locked"))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/labels/1", strings.NewReader(`{"name":"Copy"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusInternalServerError, resp.StatusCode)
+	})
+}
+
+func Test_deleteLabel(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+	m.RoleValue = testutil.Ptr("admin")
+
+	mock.ExpectExec("DELETE FROM labels").
+		WithArgs("1", m.AppIDValue).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodDelete, "/v1/labels/1", nil)
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func Test_labelPin(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+
+	mock.ExpectExec("INSERT INTO pin_labels").
+		WithArgs("1", m.AppIDValue, "2", false, m.UserIDValue).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodPut, "/v1/pins/1/labels/2", nil)
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"success":true,"error":null}`, string(body))
+}
+
+func Test_unlabelPin(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+	m.RoleValue = testutil.Ptr("moderator")
+
+	mock.ExpectExec("DELETE FROM pin_labels").
+		WithArgs("1", "2", m.AppIDValue, true, m.UserIDValue).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodDelete, "/v1/pins/1/labels/2", nil)
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
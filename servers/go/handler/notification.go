@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/handler/body"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+	NotificationStatus  = "status"
+)
+
+// notify queues a notification for everyone watching the pin except the actor.
+// Watchers in mentions get a mention instead of kind. The notifier package
+// sends them.
+func (h *Handler) notify(ctx context.Context, db sqlx.ExecerContext, kind string, pinID, actorID, commentID any, data string, mentions []int) error {
+	if !h.config.notifications {
+		return nil
+	}
+
+	buf, _ := json.Marshal(mentions)
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, pin_id, actor_id, comment_id, type, data)
+		SELECT s.user_id, s.pin_id, ?, ?, CASE WHEN s.user_id IN (SELECT value FROM json_each(?)) THEN 'mention' ELSE ? END, NULLIF(?, '')
+		FROM pin_subscriptions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.pin_id = ?
+		  AND s.user_id != ?
+		  AND u.email IS NOT NULL
+		  AND u.notifications != 'off'
+	`, actorID, commentID, string(buf), kind, data, pinID, actorID)
+	if err != nil {
+		log.Error().Err(err).Msg("notification.notify")
+		return errs.ErrInternalServerError
+	}
+	return nil
+}
+
+func (h *Handler) updateNotifications(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	var data struct {
+		Notifications string `json:"notifications" validate:"trim,required,oneof=instant daily off"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	tx := h.db.MustBeginTx(c.UserContext(), nil)
+	defer tx.Rollback()
+
+	_, err := tx.ExecContext(c.UserContext(), `
+		UPDATE users
+		SET notifications = ?
+		WHERE id = ?
+	`, data.Notifications, c.Locals(constant.UserIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("notification.updateNotifications")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	// Otherwise they would all go out at once when notifications are turned back
+	// on
+	if data.Notifications == "off" {
+		_, err := tx.ExecContext(c.UserContext(), `
+			DELETE FROM notifications
+			WHERE user_id = ?
+			  AND sent_at IS NULL
+		`, c.Locals(constant.UserIDKey))
+		if err != nil {
+			log.Error().Err(err).Msg("notification.updateNotifications")
+			result.Error = errs.ErrInternalServerError
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("notification.updateNotifications")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_notify(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("disabled", func(t *testing.T) {
+		h := New(nil, nil)
+		assert.Nil(h.notify(context.TODO(), nil, NotificationReply, 1, 1, 1, "", nil))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Setenv("SMTP_ADDR", "localhost:25")
+
+		db, mock := db.New()
+		h := New(db, nil)
+
+		mock.ExpectExec("INSERT INTO notifications").
+			WithArgs(1, 2, "[3]", NotificationReply, "", 4, 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		assert.Nil(h.notify(context.TODO(), db, NotificationReply, 4, 1, 2, "", []int{3}))
+		assert.Nil(mock.ExpectationsWereMet())
+	})
+}
+
+func Test_updateNotifications(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("daily", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET notifications").
+			WithArgs("daily", m.UserIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/users/me/notifications", strings.NewReader(`{"notifications":"daily"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+
+	t.Run("off", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET notifications").
+			WithArgs("off", m.UserIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM notifications").
+			WithArgs(m.UserIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/users/me/notifications", strings.NewReader(`{"notifications":"off"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+	})
+}
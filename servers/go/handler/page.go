@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/handler/body"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/settings"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+// pageSorts maps the sort query of pages to its ORDER BY, prefix with "-" to
+// sort descending
+var pageSorts = map[string]string{
+	"path":           "path ASC",
+	"-path":          "path DESC",
+	"open":           "open ASC, path ASC",
+	"-open":          "open DESC, path ASC",
+	"last_activity":  "last_activity_at ASC, path ASC",
+	"-last_activity": "last_activity_at DESC, path ASC",
+}
+
+func (h *Handler) pages(c *fiber.Ctx) error {
+	var result struct {
+		Nodes []*model.Page `json:"nodes"`
+		Error any           `json:"error"`
+	}
+	result.Nodes = []*model.Page{}
+
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	orderBy, ok := pageSorts[c.Query("sort", "-last_activity")]
+	if !ok {
+		result.Error = errs.MapErrors{"sort": errs.ErrInvalid}
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	limit := min(max(c.QueryInt("limit", 20), 1), 100)
+	offset := max(c.QueryInt("offset", 0), 0)
+
+	appID := c.Locals(constant.AppIDKey)
+
+	var total int
+	if err := h.db.QueryRowContext(c.UserContext(), `SELECT COUNT(DISTINCT _path) FROM pins WHERE app_id = ?`, appID).Scan(&total); err != nil {
+		log.Error().Err(err).Msg("page.pages")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	c.Set("X-Total-Count", strconv.Itoa(total))
+
+	err := h.db.SelectContext(c.UserContext(), &result.Nodes, `
+		SELECT
+		  p._path AS path,
+		  SUM(p.completed_at IS NULL) AS open,
+		  SUM(p.completed_at IS NOT NULL) AS completed,
+		  MAX((SELECT MAX(c.created_at) FROM comments c WHERE c.pin_id = p.id)) AS last_activity_at
+		FROM pins p
+		WHERE p.app_id = ?
+		GROUP BY p._path
+		ORDER BY `+orderBy+`
+		LIMIT ? OFFSET ?
+	`, appID, limit, offset)
+	if err != nil {
+		log.Error().Err(err).Msg("page.pages")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if len(result.Nodes) == 0 {
+		return c.Status(fiber.StatusOK).JSON(result)
+	}
+
+	paths := make([]string, len(result.Nodes))
+	for i, node := range result.Nodes {
+		paths[i] = node.Path
+		node.Participants = []*model.User{}
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT DISTINCT p._path, c.user_id
+		FROM comments c
+		JOIN pins p ON p.id = c.pin_id
+		WHERE p.app_id = ?
+		  AND p._path IN (?)
+		ORDER BY c.user_id ASC
+	`, appID, paths)
+	if err != nil {
+		log.Error().Err(err).Msg("page.pages")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	rows, err := h.db.QueryContext(c.UserContext(), query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("page.pages")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	defer rows.Close()
+
+	participants := make(map[string][]int)
+	var userIds []int
+	for rows.Next() {
+		var path string
+		var userID int
+		if err := rows.Scan(&path, &userID); err != nil {
+			log.Error().Err(err).Msg("page.pages")
+			result.Error = errs.ErrInternalServerError
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+		participants[path] = append(participants[path], userID)
+		userIds = append(userIds, userID)
+	}
+
+	m, err := h.getUsers(c.UserContext(), userIds)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	for _, node := range result.Nodes {
+		for _, userID := range participants[node.Path] {
+			if user, ok := m[userID]; ok {
+				node.Participants = append(node.Participants, user)
+			}
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// renamePage moves every pin of a path to another, for routes that were renamed
+func (h *Handler) renamePage(c *fiber.Ctx) error {
+	var result struct {
+		Count int `json:"count"`
+		Error any `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.UpdateSettings) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	var data struct {
+		From string `json:"from" validate:"trim,required"`
+		To   string `json:"to" validate:"trim,required"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	appID := c.Locals(constant.AppIDKey).(string)
+
+	s, err := settings.Get(c.UserContext(), h.db, appID)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	// from can be the path as it was visited, or as it was stored before the
+	// rules changed
+	res, err := h.db.ExecContext(c.UserContext(), `
+		UPDATE pins
+		SET _path = ?
+		WHERE app_id = ?
+		  AND _path IN (?, ?)
+	`, s.Paths.Normalize(data.To), appID, data.From, s.Paths.Normalize(data.From))
+	if err != nil {
+		log.Error().Err(err).Msg("page.renamePage")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	n, _ := res.RowsAffected()
+	result.Count = int(n)
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// normalizePages applies the current path rules to the pins created before
+// they were changed
+func (h *Handler) normalizePages(c *fiber.Ctx) error {
+	var result struct {
+		Count int `json:"count"`
+		Error any `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.UpdateSettings) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	appID := c.Locals(constant.AppIDKey).(string)
+
+	s, err := settings.Get(c.UserContext(), h.db, appID)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	var paths []string
+	if err := h.db.SelectContext(c.UserContext(), &paths, `SELECT DISTINCT _path FROM pins WHERE app_id = ?`, appID); err != nil {
+		log.Error().Err(err).Msg("page.normalizePages")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	tx := h.db.MustBeginTx(c.UserContext(), nil)
+	defer tx.Rollback()
+
+	for _, path := range paths {
+		to := s.Paths.Normalize(path)
+		if to == path {
+			continue
+		}
+
+		res, err := tx.ExecContext(c.UserContext(), `
+			UPDATE pins
+			SET _path = ?
+			WHERE app_id = ?
+			  AND _path = ?
+		`, to, appID, path)
+		if err != nil {
+			log.Error().Err(err).Msg("page.normalizePages")
+			result.Error = errs.ErrInternalServerError
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+
+		n, _ := res.RowsAffected()
+		result.Count += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("page.normalizePages")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
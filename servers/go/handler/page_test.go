@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_pages(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("")
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/pages", nil)
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("INVALID", func(t *testing.T) {
+		h := New(nil, nil)
+
+		app := fiber.New()
+		h.Register(app, middleware.New())
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/pages?sort=created_at", nil)
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"nodes":[],"error":{"sort":"INVALID"}}`, string(body))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT COUNT\\(DISTINCT _path\\) FROM pins").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		mock.ExpectQuery("SELECT .+ FROM pins p .+ ORDER BY open DESC, path ASC LIMIT").
+			WithArgs(m.AppIDValue, 2, 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"path", "open", "completed", "last_activity_at"}).
+					AddRow("/", 2, 1, "2024-01-01 00:00:00").
+					AddRow("/about", 1, 0, "2024-01-02 00:00:00"),
+			)
+
+		mock.ExpectQuery("SELECT DISTINCT p._path, c.user_id FROM comments c").
+			WithArgs(m.AppIDValue, "/", "/about").
+			WillReturnRows(
+				sqlmock.NewRows([]string{"_path", "user_id"}).
+					AddRow("/", 1).
+					AddRow("/", 2).
+					AddRow("/about", 2),
+			)
+
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs(1, 2, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1").AddRow(2, "User 2"))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/pages?sort=-open&limit=2&offset=1", nil)
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		assert.Equal("3", resp.Header.Get("X-Total-Count"))
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"nodes":[{"path":"/","open":2,"completed":1,"last_activity_at":"2024-01-01T00:00:00Z","participants":[{"id":1,"name":"User 1"},{"id":2,"name":"User 2"}]},{"path":"/about","open":1,"completed":0,"last_activity_at":"2024-01-02T00:00:00Z","participants":[{"id":2,"name":"User 2"}]}],"error":null}`, string(body))
+	})
+}
+
+func Test_renamePage(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+
+		app := fiber.New()
+		h.Register(app, middleware.New())
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/pages/rename", strings.NewReader(`{"from":"/a","to":"/b"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"paths":{"trim_trailing_slash":true}}`))
+
+		mock.ExpectExec("UPDATE pins SET _path").
+			WithArgs("/products", m.AppIDValue, "/shop/", "/shop").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/pages/rename", strings.NewReader(`{"from":" /shop/ ","to":"/products/"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"count":2,"error":null}`, string(body))
+	})
+}
+
+func Test_normalizePages(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+	m.RoleValue = testutil.Ptr("admin")
+
+	mock.ExpectQuery("SELECT settings FROM apps").
+		WithArgs(m.AppIDValue).
+		WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"paths":{"rewrites":[{"pattern":"^/products/[^/]+","replacement":"/products/:id"}]}}`))
+
+	mock.ExpectQuery("SELECT DISTINCT _path FROM pins").
+		WithArgs(m.AppIDValue).
+		WillReturnRows(sqlmock.NewRows([]string{"_path"}).AddRow("/").AddRow("/products/1").AddRow("/products/2"))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE pins SET _path").
+		WithArgs("/products/:id", m.AppIDValue, "/products/1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE pins SET _path").
+		WithArgs("/products/:id", m.AppIDValue, "/products/2").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodPost, "/v1/pages/normalize", nil)
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"count":4,"error":null}`, string(body))
+}
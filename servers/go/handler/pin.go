@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"strconv"
 	"strings"
@@ -10,7 +12,11 @@ import (
 	"github.com/brantem/aloy/constant"
 	"github.com/brantem/aloy/errs"
 	"github.com/brantem/aloy/handler/body"
+	"github.com/brantem/aloy/metrics"
 	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/settings"
+	"github.com/brantem/aloy/text"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
 )
@@ -22,11 +28,47 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 	}
 	result.Nodes = []*model.Pin{}
 
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	me := c.Locals(constant.UserIDKey).(string)
+
 	var userID string
 	if c.Query("me") == "1" {
-		userID = c.Locals(constant.UserIDKey).(string)
+		userID = me
 	}
 	_path := c.Query("_path")
+	version := c.Query("version")
+	w := c.QueryFloat("w")
+	var carryOpen bool
+	// Pins outside of the breakpoint of w are left out, or only flagged with
+	// breakpoint=flag
+	var hasBreakpoint bool
+	var start, end float64
+	flag := c.Query("breakpoint") == "flag"
+	if _path != "" || version != "" || w > 0 {
+		s, err := settings.Get(c.UserContext(), h.db, c.Locals(constant.AppIDKey).(string))
+		if err != nil {
+			result.Error = err
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+		if _path != "" {
+			_path = s.Paths.Normalize(_path)
+		}
+		carryOpen = s.Versions.CarryOpen
+		if w > 0 {
+			start, end, hasBreakpoint = s.Breakpoint(w)
+		}
+	}
+	environment := c.Query("environment")
+	status := c.Query("status")
+	label := c.Query("label")
+	assignee := c.Query("assignee")
+	if assignee == "me" {
+		assignee = me
+	}
 
 	rows, err := h.db.QueryxContext(c.UserContext(), `
 		WITH t AS (
@@ -36,15 +78,31 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 		  HAVING MIN(created_at)
 		)
 		SELECT
-		  p.id, p.user_id, t.id AS comment_id, p.path, p.w, p._x, p.x, p._y, p.y, p.completed_at,
-		  (SELECT COUNT(c.id)-1 FROM comments c WHERE c.pin_id = p.id) AS total_replies
+		  p.id, p.user_id, t.id AS comment_id, p.path, p.w, p._x, p.x, p._y, p.y, p.environment, p.version, p.context, p.screenshot, p.status, p.completed_at, p.detached_at,
+		  (SELECT COUNT(c.id)-1 FROM comments c WHERE c.pin_id = p.id) AS total_replies,
+		  (
+		    SELECT COUNT(c.id)
+		    FROM comments c
+		    LEFT JOIN thread_reads r ON r.pin_id = c.pin_id AND r.user_id = ?
+		    WHERE c.pin_id = p.id
+		      AND c.user_id != ?
+		      AND c.id > COALESCE(r.comment_id, 0)
+		  ) AS unread_count,
+		  EXISTS (SELECT 1 FROM pin_subscriptions s WHERE s.pin_id = p.id AND s.user_id = ?) AS watching
 		FROM pins p
 		JOIN t ON t.pin_id = p.id
 		WHERE p.app_id = ?
 		  AND CASE WHEN ? != '' THEN p.user_id = ? ELSE TRUE END
 		  AND CASE WHEN ? != '' THEN p._path = ? ELSE TRUE END
+		  AND CASE WHEN ? != '' THEN p.status = ? ELSE TRUE END
+		  AND CASE WHEN ? != '' THEN EXISTS (SELECT 1 FROM pin_assignees a WHERE a.pin_id = p.id AND a.user_id = ?) ELSE TRUE END
+		  AND CASE WHEN ? != '' THEN EXISTS (SELECT 1 FROM pin_labels l WHERE l.pin_id = p.id AND l.label_id = ?) ELSE TRUE END
+		  AND CASE WHEN ? THEN EXISTS (SELECT 1 FROM pin_subscriptions s WHERE s.pin_id = p.id AND s.user_id = ?) ELSE TRUE END
+		  AND CASE WHEN ? != '' THEN p.environment = ? ELSE TRUE END
+		  AND CASE WHEN ? != '' THEN p.version = ? OR (? AND p.completed_at IS NULL AND p.version IS NOT NULL AND p.created_at < COALESCE((SELECT MIN(v.created_at) FROM pins v WHERE v.app_id = p.app_id AND v.version = ?), CURRENT_TIMESTAMP)) ELSE TRUE END
+		  AND CASE WHEN ? THEN p.w > ? AND (? = 0 OR p.w <= ?) ELSE TRUE END
 		ORDER BY p.id DESC
-	`, c.Locals(constant.AppIDKey), userID, userID, _path, _path)
+	`, me, me, me, c.Locals(constant.AppIDKey), userID, userID, _path, _path, status, status, assignee, assignee, label, label, c.Query("watching") == "1", me, environment, environment, version, version, carryOpen, version, hasBreakpoint && !flag, start, end, end)
 	if err != nil {
 		log.Error().Err(err).Msg("pin.pins")
 		result.Error = errs.ErrInternalServerError
@@ -52,7 +110,7 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 	}
 	defer rows.Close()
 
-	var userIds, commentIds []int
+	var pinIds, userIds, commentIds []int
 	for rows.Next() {
 		var node model.Pin
 		if err := rows.StructScan(&node); err != nil {
@@ -60,6 +118,18 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 			result.Error = errs.ErrInternalServerError
 			return c.Status(fiber.StatusInternalServerError).JSON(result)
 		}
+		node.HasUnread = node.UnreadCount > 0
+		if hasBreakpoint && flag {
+			v := node.W > start && (end == 0 || node.W <= end)
+			node.InBreakpoint = &v
+		}
+		if node.RawContext.Valid {
+			node.RawContext.Unmarshal(&node.Context)
+		}
+		if node.RawScreenshot.Valid {
+			node.RawScreenshot.Unmarshal(&node.Screenshot)
+		}
+		pinIds = append(pinIds, node.ID)
 		userIds = append(userIds, node.UserID)
 		commentIds = append(commentIds, node.CommentID)
 		result.Nodes = append(result.Nodes, &node)
@@ -72,6 +142,7 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 
 	comments := make(map[int]*model.Comment, len(commentIds))
 	attachments := make(map[int][]*model.Attachment, len(commentIds))
+	reactions := make(map[int][]*model.Reaction, len(commentIds))
 
 	var wg sync.WaitGroup
 
@@ -79,7 +150,7 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 	go func() {
 		defer wg.Done()
 
-		m, err := h.getUsers(c.Context(), userIds)
+		m, err := h.getUsers(c.UserContext(), userIds)
 		if err != nil {
 			return
 		}
@@ -93,7 +164,43 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 	go func() {
 		defer wg.Done()
 
-		m, _ := h.getComments(c.UserContext(), commentIds)
+		m, err := h.getAssignees(c.UserContext(), pinIds)
+		if err != nil {
+			return
+		}
+
+		for _, node := range result.Nodes {
+			if v, ok := m[node.ID]; ok {
+				node.Assignees = v
+			} else {
+				node.Assignees = []*model.User{}
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		m, err := h.getLabels(c.UserContext(), pinIds)
+		if err != nil {
+			return
+		}
+
+		for _, node := range result.Nodes {
+			if v, ok := m[node.ID]; ok {
+				node.Labels = v
+			} else {
+				node.Labels = []*model.Label{}
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		m, err := h.getComments(c.UserContext(), commentIds)
 		if err != nil {
 			return
 		}
@@ -104,13 +211,24 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 	go func() {
 		defer wg.Done()
 
-		m, _ := h.getAttachments(c.UserContext(), commentIds)
+		m, err := h.getAttachments(c.UserContext(), commentIds)
 		if err != nil {
 			return
 		}
 		attachments = m
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		m, err := h.getReactions(c.UserContext(), commentIds, c.Locals(constant.UserIDKey))
+		if err != nil {
+			return
+		}
+		reactions = m
+	}()
+
 	wg.Wait()
 
 	for _, node := range result.Nodes {
@@ -120,11 +238,47 @@ func (h *Handler) pins(c *fiber.Ctx) error {
 		} else {
 			node.Comment.Attachments = []*model.Attachment{}
 		}
+		if v, ok := reactions[node.CommentID]; ok {
+			node.Comment.Reactions = v
+		} else {
+			node.Comment.Reactions = []*model.Reaction{}
+		}
 	}
 
 	return c.Status(fiber.StatusOK).JSON(result)
 }
 
+// parsePinContext validates the context of a new pin and returns it as it's
+// stored, the user agent falls back to the one of the request
+func parsePinContext(c *fiber.Ctx, raw string) (any, error) {
+	var v model.PinContext
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			return nil, errs.MapErrors{"context": errs.ErrInvalid}
+		}
+	}
+
+	if err := body.ValidateStruct(&v); err != nil {
+		me := make(errs.MapErrors)
+		for k, err := range err.(errs.MapErrors) {
+			me["context."+k] = err
+		}
+		return nil, me
+	}
+
+	if v.UserAgent == "" {
+		// Cut on a rune like the max=512 the field is validated with
+		ua := []rune(c.Get(fiber.HeaderUserAgent))
+		v.UserAgent = string(ua[:min(len(ua), 512)])
+	}
+
+	if v == (model.PinContext{}) {
+		return nil, nil
+	}
+	buf, _ := json.Marshal(v)
+	return string(buf), nil
+}
+
 func (h *Handler) createPin(c *fiber.Ctx) error {
 	type Pin struct {
 		ID int `json:"id"`
@@ -135,6 +289,11 @@ func (h *Handler) createPin(c *fiber.Ctx) error {
 		Error any  `json:"error"`
 	}
 
+	if !policy.Can(role(c), policy.CreatePin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
 	userID := c.Locals(constant.UserIDKey)
 
 	var data struct {
@@ -145,13 +304,32 @@ func (h *Handler) createPin(c *fiber.Ctx) error {
 		X2    float64 `form:"x" validate:"number,required"`
 		Y     float64 `form:"_y" validate:"number,required"`
 		Y2    float64 `form:"y" validate:"number,required"`
-		Text  string  `form:"text" validate:"trim,required"`
+		// Environment and Version tell apart the deploys of an app, like a
+		// preview and production or the git SHA of a build
+		Environment string `form:"environment" validate:"trim,max=64"`
+		Version     string `form:"version" validate:"trim,max=64"`
+		// Context is a model.PinContext as JSON
+		Context string `form:"context"`
+		Text    string `form:"text" validate:"trim,required"`
 	}
 	if err := body.Parse(c, &data); err != nil {
 		result.Error = err
 		return c.Status(fiber.StatusBadRequest).JSON(result)
 	}
 
+	pinContext, err := parsePinContext(c, data.Context)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	// Attachments are only uploaded once every file is valid
+	screenshotFile, err := h.screenshotFile(c)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
 	attachments, err := h.uploadAttachments(c)
 	if err != nil {
 		result.Error = err
@@ -163,14 +341,42 @@ func (h *Handler) createPin(c *fiber.Ctx) error {
 		return c.JSON(result)
 	}
 
+	// Nothing points to the uploads until the pin is created
+	uploads := attachments
+	defer func() {
+		if result.Pin == nil {
+			h.deleteUploads(c.UserContext(), uploads)
+		}
+	}()
+
+	var screenshot any
+	if v, err := h.uploadScreenshot(c.UserContext(), screenshotFile); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	} else if v != nil {
+		uploads = append(uploads, v)
+		buf, _ := json.Marshal(map[string]any{"url": v.URL, "data": v.Data})
+		screenshot = string(buf)
+	}
+
+	appID := c.Locals(constant.AppIDKey).(string)
+
+	s, err := settings.Get(c.UserContext(), h.db, appID)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	data.Path = s.Paths.Normalize(data.Path)
+
 	tx := h.db.MustBeginTx(c.UserContext(), nil)
 
 	var pin Pin
 	err = tx.QueryRowContext(c.UserContext(), `
-		INSERT INTO pins (app_id, user_id, _path, path, w, _x, x, _y, y)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO pins (app_id, user_id, _path, path, w, _x, x, _y, y, environment, version, context, screenshot, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?)
 		RETURNING id
-	`, c.Locals(constant.AppIDKey), userID, data.Path, data.Path2, data.W, data.X, data.X2, data.Y, data.Y2).Scan(&pin.ID)
+	`, appID, userID, data.Path, data.Path2, data.W, data.X, data.X2, data.Y, data.Y2, data.Environment, data.Version, pinContext, screenshot, s.DefaultStatus().Key).Scan(&pin.ID)
 	if err != nil {
 		tx.Rollback()
 		log.Error().Err(err).Msg("pin.createPin")
@@ -191,6 +397,23 @@ func (h *Handler) createPin(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(result)
 	}
 
+	mentions := text.Mentions(data.Text)
+	userIds := []any{userID}
+	for _, id := range mentions {
+		userIds = append(userIds, id)
+	}
+	if err := subscribe(c.UserContext(), tx, appID, pin.ID, userIds); err != nil {
+		tx.Rollback()
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if err := h.notify(c.UserContext(), tx, NotificationReply, pin.ID, userID, commentID, "", mentions); err != nil {
+		tx.Rollback()
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
 	if len(attachments) > 0 {
 		qb := sq.Insert("attachments").Columns("comment_id", "url", "data")
 		for _, attachment := range attachments {
@@ -209,6 +432,9 @@ func (h *Handler) createPin(c *fiber.Ctx) error {
 	tx.Commit()
 	result.Pin = &pin
 
+	metrics.PinsCreated.WithLabelValues(metrics.App(appID)).Inc()
+	metrics.CommentsCreated.WithLabelValues(metrics.App(appID)).Inc()
+
 	return c.Status(fiber.StatusOK).JSON(result)
 }
 
@@ -218,30 +444,20 @@ func (h *Handler) completePin(c *fiber.Ctx) error {
 		Error   any  `json:"error"`
 	}
 
-	if v := strings.TrimSpace(string(c.BodyRaw())); v == "1" {
-		_, err := h.db.ExecContext(c.UserContext(), `
-			UPDATE pins
-			SET completed_at = CURRENT_TIMESTAMP, completed_by_id = ?
-			WHERE id = ?
-			  AND completed_at IS NULL
-		`, c.Locals(constant.UserIDKey), c.Params("pinId"))
-		if err != nil {
-			log.Error().Err(err).Msg("pin.completePin")
-			result.Error = errs.ErrInternalServerError
-			return c.Status(fiber.StatusInternalServerError).JSON(result)
+	complete := strings.TrimSpace(string(c.BodyRaw())) == "1"
+
+	status, err := h.changePinStatus(c, func(s *model.Settings, current *model.Status) string {
+		if current != nil && current.Closed == complete {
+			return current.Key
 		}
-	} else {
-		_, err := h.db.ExecContext(c.UserContext(), `
-			UPDATE pins
-			SET completed_at = NULL, completed_by_id = NULL
-			WHERE id = ?
-			  AND completed_at IS NOT NULL
-		`, c.Params("pinId"))
-		if err != nil {
-			log.Error().Err(err).Msg("pin.completePin")
-			result.Error = errs.ErrInternalServerError
-			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		if complete {
+			return s.ClosedStatus().Key
 		}
+		return s.DefaultStatus().Key
+	})
+	if err != nil {
+		result.Error = err
+		return c.Status(status).JSON(result)
 	}
 
 	result.Success = true
@@ -254,11 +470,18 @@ func (h *Handler) deletePin(c *fiber.Ctx) error {
 		Error   any  `json:"error"`
 	}
 
+	r := role(c)
+	if !policy.Can(r, policy.DeletePin) && !policy.Can(r, policy.DeleteAnyPin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
 	_, err := h.db.ExecContext(c.UserContext(), `
 		DELETE FROM pins
 		WHERE id = ?
-		  AND user_id = ?
-	`, c.Params("pinId"), c.Locals(constant.UserIDKey))
+		  AND app_id = ?
+		  AND CASE WHEN ? THEN TRUE ELSE user_id = ? END
+	`, c.Params("pinId"), c.Locals(constant.AppIDKey), policy.Can(r, policy.DeleteAnyPin), c.Locals(constant.UserIDKey))
 	if err != nil {
 		log.Error().Err(err).Msg("pin.deletePin")
 		result.Error = errs.ErrInternalServerError
@@ -269,6 +492,26 @@ func (h *Handler) deletePin(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(result)
 }
 
+// checkPin returns errs.ErrNotFound when pinID isn't a pin of appID, for
+// handlers that would otherwise reach into another app's pins
+func (h *Handler) checkPin(ctx context.Context, pinID, appID any) error {
+	var id int
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id
+		FROM pins
+		WHERE id = ?
+		  AND app_id = ?
+	`, pinID, appID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errs.ErrNotFound
+		}
+		log.Error().Err(err).Msg("pin.checkPin")
+		return errs.ErrInternalServerError
+	}
+	return nil
+}
+
 func (h *Handler) pinComments(c *fiber.Ctx) error {
 	var result struct {
 		Nodes []*model.Comment `json:"nodes"`
@@ -276,6 +519,19 @@ func (h *Handler) pinComments(c *fiber.Ctx) error {
 	}
 	result.Nodes = []*model.Comment{}
 
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	if err := h.checkPin(c.UserContext(), c.Params("pinId"), c.Locals(constant.AppIDKey)); err != nil {
+		result.Error = err
+		if err == errs.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(result)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
 	rows, err := h.db.QueryxContext(c.UserContext(), `
 		SELECT id, user_id, text, created_at, updated_at
 		FROM comments
@@ -314,7 +570,7 @@ func (h *Handler) pinComments(c *fiber.Ctx) error {
 	go func() {
 		defer wg.Done()
 
-		m, err := h.getUsers(c.Context(), userIds)
+		m, err := h.getUsers(c.UserContext(), userIds)
 		if err != nil {
 			return
 		}
@@ -328,7 +584,7 @@ func (h *Handler) pinComments(c *fiber.Ctx) error {
 	go func() {
 		defer wg.Done()
 
-		m, err := h.getAttachments(c.Context(), commentIds)
+		m, err := h.getAttachments(c.UserContext(), commentIds)
 		if err != nil {
 			return
 		}
@@ -342,6 +598,24 @@ func (h *Handler) pinComments(c *fiber.Ctx) error {
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		m, err := h.getReactions(c.UserContext(), commentIds, c.Locals(constant.UserIDKey))
+		if err != nil {
+			return
+		}
+
+		for _, node := range result.Nodes {
+			if v, ok := m[node.ID]; ok {
+				node.Reactions = v
+			} else {
+				node.Reactions = []*model.Reaction{}
+			}
+		}
+	}()
+
 	wg.Wait()
 
 	return c.Status(fiber.StatusOK).JSON(result)
@@ -357,6 +631,11 @@ func (h *Handler) createComment(c *fiber.Ctx) error {
 		Error   any      `json:"error"`
 	}
 
+	if !policy.Can(role(c), policy.CreateComment) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
 	var data struct {
 		Text string `form:"text" validate:"trim,required"`
 	}
@@ -365,6 +644,14 @@ func (h *Handler) createComment(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(result)
 	}
 
+	if err := h.checkPin(c.UserContext(), c.Params("pinId"), c.Locals(constant.AppIDKey)); err != nil {
+		result.Error = err
+		if err == errs.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(result)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
 	attachments, err := h.uploadAttachments(c)
 	if err != nil {
 		result.Error = err
@@ -376,6 +663,13 @@ func (h *Handler) createComment(c *fiber.Ctx) error {
 		return c.JSON(result)
 	}
 
+	// Nothing points to the uploads until the comment is created
+	defer func() {
+		if result.Comment == nil {
+			h.deleteUploads(c.UserContext(), attachments)
+		}
+	}()
+
 	tx := h.db.MustBeginTx(c.UserContext(), nil)
 
 	var comment Comment
@@ -391,6 +685,30 @@ func (h *Handler) createComment(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(result)
 	}
 
+	// Replying means the user has seen the thread
+	if err := markRead(c.UserContext(), tx, c.Locals(constant.UserIDKey), c.Params("pinId"), comment.ID); err != nil {
+		tx.Rollback()
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	mentions := text.Mentions(data.Text)
+	userIds := []any{c.Locals(constant.UserIDKey)}
+	for _, id := range mentions {
+		userIds = append(userIds, id)
+	}
+	if err := subscribe(c.UserContext(), tx, c.Locals(constant.AppIDKey), c.Params("pinId"), userIds); err != nil {
+		tx.Rollback()
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if err := h.notify(c.UserContext(), tx, NotificationReply, c.Params("pinId"), c.Locals(constant.UserIDKey), comment.ID, "", mentions); err != nil {
+		tx.Rollback()
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
 	if len(attachments) > 0 {
 		qb := sq.Insert("attachments").Columns("comment_id", "url", "data")
 		for _, attachment := range attachments {
@@ -409,5 +727,7 @@ func (h *Handler) createComment(c *fiber.Ctx) error {
 	tx.Commit()
 	result.Comment = &comment
 
+	metrics.CommentsCreated.WithLabelValues(metrics.App(c.Locals(constant.AppIDKey).(string))).Inc()
+
 	return c.Status(fiber.StatusOK).JSON(result)
 }
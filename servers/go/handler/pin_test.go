@@ -3,6 +3,8 @@ package handler
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/png"
@@ -13,10 +15,13 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/errs"
 	"github.com/brantem/aloy/testutil"
 	"github.com/brantem/aloy/testutil/db"
 	"github.com/brantem/aloy/testutil/middleware"
 	"github.com/brantem/aloy/testutil/storage"
+	"github.com/brantem/aloy/testutil/tracing"
+	_tracing "github.com/brantem/aloy/tracing"
 	"github.com/galdor/go-thumbhash"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -31,7 +36,7 @@ func Test_pins(t *testing.T) {
 		m := middleware.New()
 
 		mock.ExpectQuery("SELECT .+ FROM pins").
-			WithArgs(m.AppIDValue, "", "", "", "").
+			WithArgs(m.UserIDValue, m.UserIDValue, m.UserIDValue, m.AppIDValue, "", "", "", "", "", "", "", "", "", "", false, m.UserIDValue, "", "", "", "", false, "", false, 0.0, 0.0, 0.0).
 			WillReturnRows(&sqlmock.Rows{})
 
 		app := fiber.New()
@@ -54,17 +59,29 @@ func Test_pins(t *testing.T) {
 
 		mock.MatchExpectationsInOrder(false)
 
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"paths":{"trim_trailing_slash":true},"breakpoints":[640,768,1024]}`))
+
 		mock.ExpectQuery("SELECT .+ FROM pins").
-			WithArgs(m.AppIDValue, m.UserIDValue, m.UserIDValue, "/abc", "/abc").
+			WithArgs(m.UserIDValue, m.UserIDValue, m.UserIDValue, m.AppIDValue, m.UserIDValue, m.UserIDValue, "/abc", "/abc", "open", "open", m.UserIDValue, m.UserIDValue, "1", "1", true, m.UserIDValue, "preview", "preview", "abc123", "abc123", true, "abc123", true, 768.0, 1024.0, 1024.0).
 			WillReturnRows(
-				sqlmock.NewRows([]string{"id", "user_id", "path", "w", "_x", "x", "_y", "y", "completed_at", "comment_id", "total_replies"}).
-					AddRow(1, 1, "body", 1080, 100, 100, 100, 100, nil, 1, 0),
+				sqlmock.NewRows([]string{"id", "user_id", "path", "w", "_x", "x", "_y", "y", "context", "screenshot", "status", "completed_at", "comment_id", "total_replies", "unread_count", "watching"}).
+					AddRow(1, 1, "body", 1080, 100, 100, 100, 100, `{"h":720,"breakpoint":"md"}`, `{"url":"https://example.com/a.png","data":{"type":"image/png"}}`, "open", nil, 1, 0, 1, true),
 			)
 
 		mock.ExpectQuery("SELECT .+ FROM users").
 			WithArgs(1).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1"))
 
+		mock.ExpectQuery("SELECT .+ FROM pin_assignees").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"pin_id", "id", "name"}).AddRow(1, 2, "User 2"))
+
+		mock.ExpectQuery("SELECT .+ FROM pin_labels").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"pin_id", "id", "name", "color"}).AddRow(1, 1, "Bug", "#ff0000"))
+
 		mock.ExpectQuery("SELECT .+ FROM comments").
 			WithArgs(1).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "text", "created_at", "updated_at"}).AddRow(1, "Test", "2024-01-01 00:00:00", "2024-01-01 00:00:00"))
@@ -73,41 +90,235 @@ func Test_pins(t *testing.T) {
 			WithArgs(1).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "comment_id"}))
 
+		mock.ExpectQuery("SELECT .+ FROM comment_reactions").
+			WithArgs(m.UserIDValue, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"comment_id", "emoji", "count", "reacted"}).AddRow(1, "+1", 2, true))
+
 		app := fiber.New()
 		h.Register(app, m)
 
-		req := httptest.NewRequest(fiber.MethodGet, "/v1/pins?me=1&_path=/abc", nil)
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/pins?me=1&_path=/abc/&status=open&assignee=me&label=1&watching=1&environment=preview&version=abc123&w=800", nil)
 
 		resp, _ := app.Test(req)
 		assert.Nil(mock.ExpectationsWereMet())
 		assert.Equal(fiber.StatusOK, resp.StatusCode)
 		assert.Equal("1", resp.Header.Get("X-Total-Count"))
 		body, _ := io.ReadAll(resp.Body)
-		assert.Equal(`{"nodes":[{"id":1,"user":{"id":1,"name":"User 1"},"comment":{"id":1,"text":"Test","attachments":[],"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"},"path":"body","w":1080,"_x":100,"x":100,"_y":100,"y":100,"completed_at":null,"total_replies":0}],"error":null}`, string(body))
+		assert.Equal(`{"nodes":[{"id":1,"user":{"id":1,"name":"User 1"},"assignees":[{"id":2,"name":"User 2"}],"labels":[{"id":1,"name":"Bug","color":"#ff0000"}],"comment":{"id":1,"text":"Test","attachments":[],"reactions":[{"emoji":"+1","count":2,"reacted":true}],"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"},"path":"body","w":1080,"_x":100,"x":100,"_y":100,"y":100,"environment":null,"version":null,"context":{"h":720,"breakpoint":"md"},"screenshot":{"url":"https://example.com/a.png","data":{"type":"image/png"}},"status":"open","completed_at":null,"detached_at":null,"total_replies":0,"unread_count":1,"has_unread":true,"watching":true}],"error":null}`, string(body))
+	})
+	t.Run("breakpoint=flag", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.MatchExpectationsInOrder(false)
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"breakpoints":[640,768,1024]}`))
+
+		mock.ExpectQuery("SELECT .+ FROM pins").
+			WithArgs(m.UserIDValue, m.UserIDValue, m.UserIDValue, m.AppIDValue, "", "", "", "", "", "", "", "", "", "", false, m.UserIDValue, "", "", "", "", true, "", false, 768.0, 1024.0, 1024.0).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "user_id", "w", "comment_id"}).
+					AddRow(1, 1, 800, 1).
+					AddRow(2, 1, 375, 2),
+			)
+		mock.ExpectQuery("SELECT .+ FROM users").WithArgs(1, 1).WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1"))
+		mock.ExpectQuery("SELECT .+ FROM pin_assignees").WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"pin_id", "id", "name"}))
+		mock.ExpectQuery("SELECT .+ FROM pin_labels").WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"pin_id", "id", "name", "color"}))
+		mock.ExpectQuery("SELECT .+ FROM comments").WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		mock.ExpectQuery("SELECT .+ FROM attachments").WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"id", "comment_id"}))
+		mock.ExpectQuery("SELECT .+ FROM comment_reactions").WithArgs(m.UserIDValue, 1, 2).WillReturnRows(sqlmock.NewRows([]string{"comment_id", "emoji", "count", "reacted"}))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/pins?w=800&breakpoint=flag", nil)
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		var body struct {
+			Nodes []struct {
+				ID           int  `json:"id"`
+				InBreakpoint bool `json:"in_breakpoint"`
+			} `json:"nodes"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		assert.Len(body.Nodes, 2)
+		assert.True(body.Nodes[0].InBreakpoint)
+		assert.False(body.Nodes[1].InBreakpoint)
+	})
+
+	t.Run("trace", func(t *testing.T) {
+		exporter := tracing.New()
+
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.MatchExpectationsInOrder(false)
+
+		mock.ExpectQuery("SELECT .+ FROM pins").
+			WithArgs(m.UserIDValue, m.UserIDValue, m.UserIDValue, m.AppIDValue, "", "", "", "", "", "", "", "", "", "", false, m.UserIDValue, "", "", "", "", false, "", false, 0.0, 0.0, 0.0).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "user_id", "path", "w", "_x", "x", "_y", "y", "status", "completed_at", "comment_id", "total_replies", "unread_count", "watching"}).
+					AddRow(1, 1, "body", 1080, 100, 100, 100, 100, "open", nil, 1, 0, 1, true),
+			)
+		mock.ExpectQuery("SELECT .+ FROM users").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1"))
+		mock.ExpectQuery("SELECT .+ FROM pin_assignees").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"pin_id", "id", "name"}))
+		mock.ExpectQuery("SELECT .+ FROM pin_labels").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"pin_id", "id", "name", "color"}))
+		mock.ExpectQuery("SELECT .+ FROM comments").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT .+ FROM attachments").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "comment_id"}))
+		mock.ExpectQuery("SELECT .+ FROM comment_reactions").WithArgs(m.UserIDValue, 1).WillReturnRows(sqlmock.NewRows([]string{"comment_id", "emoji", "count", "reacted"}))
+
+		app := fiber.New()
+		app.Use(_tracing.Middleware)
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/pins", nil)
+
+		app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+
+		spans := exporter.GetSpans()
+		names := make([]string, len(spans))
+		for i, span := range spans {
+			names[i] = span.Name
+			assert.Equal(spans[len(spans)-1].SpanContext.TraceID(), span.SpanContext.TraceID())
+		}
+		assert.ElementsMatch([]string{"user.getUsers", "assignee.getAssignees", "label.getLabels", "comment.getComments", "attachment.getAttachments", "reaction.getReactions", "GET /v1/pins/"}, names)
 	})
 }
 
+func Test_pins_carryOpen(t *testing.T) {
+	db := db.NewSQLite(t, "../../migrations")
+	h := New(db, nil)
+	m := middleware.New()
+
+	db.MustExec(`INSERT INTO users (id, _id, app_id, name) VALUES (1, 'a', 'test', 'User 1')`)
+	db.MustExec(`
+		INSERT INTO pins (id, app_id, user_id, _path, path, w, _x, x, _y, y, version, created_at, completed_at)
+		VALUES
+		  (1, 'test', 1, '/', 'body', 1, 1, 1, 1, 1, 'v1', '2024-01-01 00:00:00', NULL),
+		  (2, 'test', 1, '/', 'body', 1, 1, 1, 1, 1, 'v1', '2024-01-01 00:00:00', '2024-01-02 00:00:00'),
+		  (3, 'test', 1, '/', 'body', 1, 1, 1, 1, 1, 'v2', '2024-01-03 00:00:00', NULL),
+		  (4, 'test', 1, '/', 'body', 1, 1, 1, 1, 1, 'v3', '2024-01-05 00:00:00', NULL),
+		  (5, 'test', 1, '/', 'body', 1, 1, 1, 1, 1, NULL, '2024-01-01 00:00:00', NULL)
+	`)
+	db.MustExec(`INSERT INTO comments (pin_id, user_id, text) SELECT id, 1, 'Test' FROM pins`)
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	ids := func(version string) []int {
+		resp, _ := app.Test(httptest.NewRequest(fiber.MethodGet, "/v1/pins?version="+version, nil))
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var result struct {
+			Nodes []struct {
+				ID int `json:"id"`
+			} `json:"nodes"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		var ids []int
+		for _, node := range result.Nodes {
+			ids = append(ids, node.ID)
+		}
+		return ids
+	}
+
+	// Open pins of older versions, but not of newer ones or without a version
+	assert.Equal(t, []int{3, 1}, ids("v2"))
+	assert.Equal(t, []int{4, 3, 1}, ids("v3"))
+	// A version without pins yet is the latest deploy
+	assert.Equal(t, []int{4, 3, 1}, ids("v4"))
+}
+
+func Test_pins_breakpoint(t *testing.T) {
+	db := db.NewSQLite(t, "../../migrations")
+	h := New(db, nil)
+	m := middleware.New()
+
+	db.MustExec(`INSERT INTO apps (id, settings) VALUES ('test', '{"breakpoints":[640,768,1024]}')`)
+	db.MustExec(`INSERT INTO users (id, _id, app_id, name) VALUES (1, 'a', 'test', 'User 1')`)
+	db.MustExec(`
+		INSERT INTO pins (id, app_id, user_id, _path, path, w, _x, x, _y, y)
+		VALUES
+		  (1, 'test', 1, '/', 'body', 320, 1, 1, 1, 1),
+		  (2, 'test', 1, '/', 'body', 640, 1, 1, 1, 1),
+		  (3, 'test', 1, '/', 'body', 700, 1, 1, 1, 1),
+		  (4, 'test', 1, '/', 'body', 768, 1, 1, 1, 1),
+		  (5, 'test', 1, '/', 'body', 1080, 1, 1, 1, 1)
+	`)
+	db.MustExec(`INSERT INTO comments (pin_id, user_id, text) SELECT id, 1, 'Test' FROM pins`)
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	ids := func(w string) []int {
+		resp, _ := app.Test(httptest.NewRequest(fiber.MethodGet, "/v1/pins?w="+w, nil))
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+		var result struct {
+			Nodes []struct {
+				ID int `json:"id"`
+			} `json:"nodes"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+
+		var ids []int
+		for _, node := range result.Nodes {
+			ids = append(ids, node.ID)
+		}
+		return ids
+	}
+
+	// Pins at exactly a breakpoint belong to the range below it
+	assert.Equal(t, []int{2, 1}, ids("320"))
+	assert.Equal(t, []int{2, 1}, ids("640"))
+	assert.Equal(t, []int{4, 3}, ids("768"))
+	assert.Equal(t, []int{4, 3}, ids("641"))
+	assert.Equal(t, []int(nil), ids("800"))
+	assert.Equal(t, []int{5}, ids("1080"))
+}
+
 func Test_createPin(t *testing.T) {
+	t.Setenv("ASSETS_BASE_URL", "https://assets.aloy.com")
+
 	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
 	hash := base64.StdEncoding.EncodeToString(thumbhash.EncodeImage(img))
 
+	// The key of the screenshot is only known after the upload
+	screenshotArg := &db.Capture{}
+
 	db, mock := db.New()
 	storage := storage.New()
 	h := New(db, storage)
 	m := middleware.New()
 
+	mock.ExpectQuery("SELECT settings FROM apps").
+		WithArgs(m.AppIDValue).
+		WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"statuses":[{"key":"new","name":"New"},{"key":"done","name":"Done","closed":true}]}`))
+
 	mock.ExpectBegin()
 
 	pinID := 1
 	mock.ExpectQuery("INSERT INTO pins").
-		WithArgs(m.AppIDValue, m.UserIDValue, "/", "body", float64(1080), float64(100), float64(100), float64(100), float64(100)).
+		WithArgs(m.AppIDValue, m.UserIDValue, "/", "body", float64(1080), float64(100), float64(100), float64(100), float64(100), "preview", "abc123", `{"h":720,"dpr":2,"user_agent":"Test","breakpoint":"md","url":"https://example.com/?a=1","color_scheme":"dark","locale":"en-US"}`, screenshotArg, "new").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(pinID))
 
 	commentID := int64(1)
 	mock.ExpectQuery("INSERT INTO comments").
-		WithArgs(pinID, m.UserIDValue, "Test").
+		WithArgs(pinID, m.UserIDValue, `[{"type":"paragraph","children":[{"type":"mention","user_id":2,"children":[{"text":""}]}]}]`).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(commentID))
 
+	mock.ExpectExec("INSERT INTO pin_subscriptions").
+		WithArgs(pinID, m.UserIDValue, 2, m.AppIDValue).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
 	mock.ExpectExec("INSERT INTO attachments").
 		WithArgs(commentID, sqlmock.AnyArg(), fmt.Sprintf(`{"hash":"%s","type":"image/png"}`, hash)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
@@ -121,14 +332,17 @@ func Test_createPin(t *testing.T) {
 	writer := multipart.NewWriter(buf)
 
 	data := map[string]string{
-		"_path": " / ",
-		"path":  " body ",
-		"w":     "1080",
-		"_x":    "100",
-		"x":     "100",
-		"_y":    "100",
-		"y":     "100",
-		"text":  " Test ",
+		"_path":       " / ",
+		"path":        " body ",
+		"w":           "1080",
+		"_x":          "100",
+		"x":           "100",
+		"_y":          "100",
+		"y":           "100",
+		"environment": " preview ",
+		"version":     "abc123",
+		"context":     `{"h":720,"dpr":2,"breakpoint":" md ","url":"https://example.com/?a=1","color_scheme":"dark","locale":"en-US"}`,
+		"text":        ` [{"type":"paragraph","children":[{"type":"mention","user_id":2,"children":[{"text":""}]}]}] `,
 	}
 	for k, v := range data {
 		field, _ := writer.CreateFormField(k)
@@ -138,29 +352,208 @@ func Test_createPin(t *testing.T) {
 	attachment1 := testutil.CreateFormFile(writer, "attachments", "a.png", "image/png")
 	png.Encode(attachment1, img)
 
+	screenshot := testutil.CreateFormFile(writer, "screenshot", "b.png", "image/png")
+	png.Encode(screenshot, img)
+
 	writer.Close()
 
 	req := httptest.NewRequest(fiber.MethodPost, "/v1/pins", buf)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("User-Agent", "Test")
 
 	resp, _ := app.Test(req)
 	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 2, storage.UploadN)
+	assert.Regexp(t, `^screenshots/\d+-[0-9a-f]{8}\.png$`, storage.UploadOpts[1].Key)
+	assert.Equal(t, fmt.Sprintf(`{"data":{"hash":"%s","type":"image/png"},"url":"https://assets.aloy.com/%s"}`, hash, storage.UploadOpts[1].Key), screenshotArg.Value)
 	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
 	body, _ := io.ReadAll(resp.Body)
 	assert.Equal(t, `{"pin":{"id":1},"error":null}`, string(body))
 }
 
+func Test_createPin_invalidScreenshot(t *testing.T) {
+	t.Setenv("SCREENSHOT_MAX_SIZE", "200b")
+
+	storage := storage.New()
+	h := New(nil, storage)
+
+	app := fiber.New()
+	h.Register(app, middleware.New())
+
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+
+	data := map[string]string{
+		"_path":   "/",
+		"path":    "body",
+		"w":       "1080",
+		"_x":      "100",
+		"x":       "100",
+		"_y":      "100",
+		"y":       "100",
+		"context": `{"h":720,"dpr":2}`,
+		"text":    `[{"type":"paragraph","children":[{"text":"a"}]}]`,
+	}
+	for k, v := range data {
+		field, _ := writer.CreateFormField(k)
+		field.Write([]byte(v))
+	}
+
+	attachment1 := testutil.CreateFormFile(writer, "attachments", "a.png", "image/png")
+	png.Encode(attachment1, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	screenshot := testutil.CreateFormFile(writer, "screenshot", "b.png", "image/png")
+	screenshot.Write(bytes.Repeat([]byte("a"), 300))
+
+	writer.Close()
+
+	req := httptest.NewRequest(fiber.MethodPost, "/v1/pins", buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, _ := app.Test(req)
+	// Nothing is uploaded when any file is invalid
+	assert.Equal(t, 0, storage.UploadN)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"pin":null,"error":{"screenshot":"TOO_BIG"}}`, string(body))
+}
+
+func Test_createPin_deleteUploads(t *testing.T) {
+	t.Setenv("ASSETS_BASE_URL", "https://assets.aloy.com")
+	t.Setenv("ATTACHMENT_SUPPORTED_TYPES", "image/png")
+
+	db, mock := db.New()
+	storage := storage.New()
+	h := New(db, storage)
+	m := middleware.New()
+
+	mock.ExpectQuery("SELECT settings FROM apps").
+		WithArgs(m.AppIDValue).
+		WillReturnError(errors.New("a"))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+
+	data := map[string]string{
+		"_path":   "/",
+		"path":    "body",
+		"w":       "1080",
+		"_x":      "100",
+		"x":       "100",
+		"_y":      "100",
+		"y":       "100",
+		"context": `{"h":720,"dpr":2}`,
+		"text":    `[{"type":"paragraph","children":[{"text":"a"}]}]`,
+	}
+	for k, v := range data {
+		field, _ := writer.CreateFormField(k)
+		field.Write([]byte(v))
+	}
+
+	attachment1 := testutil.CreateFormFile(writer, "attachments", "a.png", "image/png")
+	png.Encode(attachment1, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	screenshot := testutil.CreateFormFile(writer, "screenshot", "b.png", "image/png")
+	png.Encode(screenshot, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	writer.Close()
+
+	req := httptest.NewRequest(fiber.MethodPost, "/v1/pins", buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 2, storage.UploadN)
+	assert.Equal(t, [][]string{{storage.UploadOpts[0].Key, storage.UploadOpts[1].Key}}, storage.DeleteMultipleKeys)
+	assert.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+}
+
+func Test_parsePinContext(t *testing.T) {
+	assert := assert.New(t)
+
+	parse := func(raw, ua string) (v any, err error) {
+		app := fiber.New()
+		app.Post("/", func(c *fiber.Ctx) error {
+			v, err = parsePinContext(c, raw)
+			return nil
+		})
+
+		req := httptest.NewRequest(fiber.MethodPost, "/", nil)
+		if ua != "" {
+			req.Header.Set("User-Agent", ua)
+		}
+		app.Test(req)
+		return
+	}
+
+	v, err := parse("", "")
+	assert.Nil(v)
+	assert.Nil(err)
+
+	v, err = parse("", "Test")
+	assert.Equal(`{"user_agent":"Test"}`, v)
+	assert.Nil(err)
+
+	v, err = parse("", "a"+strings.Repeat("é", 512))
+	assert.Equal(`{"user_agent":"a`+strings.Repeat("é", 511)+`"}`, v)
+	assert.Nil(err)
+
+	v, err = parse(`{"user_agent":"Browser"}`, "Test")
+	assert.Equal(`{"user_agent":"Browser"}`, v)
+	assert.Nil(err)
+
+	_, err = parse(`[]`, "")
+	assert.Equal(errs.MapErrors{"context": errs.ErrInvalid}, err)
+
+	_, err = parse(`{"dpr":-1,"url":"example.com","color_scheme":"blue","locale":"?"}`, "")
+	assert.Equal(errs.MapErrors{
+		"context.dpr":          errs.ErrInvalid,
+		"context.url":          errs.ErrInvalid,
+		"context.color_scheme": errs.ErrInvalid,
+		"context.locale":       errs.ErrInvalid,
+	}, err)
+}
+
 func Test_completePin(t *testing.T) {
 	assert := assert.New(t)
 
+	expect := func(mock sqlmock.Sqlmock, m *middleware.Middleware, userID int, from, to string, closed bool) {
+		mock.ExpectBegin()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectQuery("SELECT user_id, status FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(userID, from))
+
+		if from == to {
+			mock.ExpectRollback()
+			return
+		}
+
+		mock.ExpectExec("UPDATE pins SET status").
+			WithArgs(to, closed, closed, m.UserIDValue, "1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectExec("INSERT INTO pin_statuses").
+			WithArgs("1", m.UserIDValue, from, to).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		mock.ExpectCommit()
+	}
+
 	t.Run("body == 1", func(t *testing.T) {
 		db, mock := db.New()
 		h := New(db, nil)
 		m := middleware.New()
+		m.UserIDValue = testutil.Ptr("1")
 
-		mock.ExpectExec("UPDATE pins SET completed_at = CURRENT_TIMESTAMP").
-			WithArgs(m.UserIDValue, "1").
-			WillReturnResult(sqlmock.NewResult(0, 1))
+		expect(mock, m, 1, "in_progress", "resolved", true)
 
 		app := fiber.New()
 		h.Register(app, m)
@@ -178,10 +571,9 @@ func Test_completePin(t *testing.T) {
 		db, mock := db.New()
 		h := New(db, nil)
 		m := middleware.New()
+		m.UserIDValue = testutil.Ptr("1")
 
-		mock.ExpectExec("UPDATE pins SET completed_at = NULL").
-			WithArgs("1").
-			WillReturnResult(sqlmock.NewResult(0, 1))
+		expect(mock, m, 1, "wont_fix", "open", false)
 
 		app := fiber.New()
 		h.Register(app, m)
@@ -194,37 +586,178 @@ func Test_completePin(t *testing.T) {
 		body, _ := io.ReadAll(resp.Body)
 		assert.Equal(`{"success":true,"error":null}`, string(body))
 	})
+
+	t.Run("already completed", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		expect(mock, m, 1, "wont_fix", "wont_fix", true)
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/pins/1/complete", strings.NewReader("1"))
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("moderator", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		expect(mock, m, 2, "resolved", "open", false)
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/pins/1/complete", strings.NewReader("0"))
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectBegin()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectQuery("SELECT user_id, status FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(2, "open"))
+
+		mock.ExpectRollback()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/pins/1/complete", strings.NewReader("1"))
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":false,"error":{"code":"FORBIDDEN"}}`, string(body))
+	})
+
+	t.Run("NOT_FOUND", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectBegin()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectQuery("SELECT user_id, status FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectRollback()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/pins/1/complete", strings.NewReader("1"))
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusNotFound, resp.StatusCode)
+	})
 }
 
 func Test_deletePin(t *testing.T) {
-	db, mock := db.New()
-	h := New(db, nil)
-	m := middleware.New()
+	assert := assert.New(t)
 
-	mock.ExpectExec("DELETE FROM pins").
-		WithArgs("1", m.UserIDValue).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	t.Run("member", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
 
-	app := fiber.New()
-	h.Register(app, m)
+		mock.ExpectExec("DELETE FROM pins").
+			WithArgs("1", m.AppIDValue, false, m.UserIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 1))
 
-	req := httptest.NewRequest(fiber.MethodDelete, "/v1/pins/1", nil)
+		app := fiber.New()
+		h.Register(app, m)
 
-	resp, _ := app.Test(req)
-	assert.Nil(t, mock.ExpectationsWereMet())
-	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
-	body, _ := io.ReadAll(resp.Body)
-	assert.Equal(t, `{"success":true,"error":null}`, string(body))
+		req := httptest.NewRequest(fiber.MethodDelete, "/v1/pins/1", nil)
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+
+	t.Run("moderator", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		mock.ExpectExec("DELETE FROM pins").
+			WithArgs("1", m.AppIDValue, true, m.UserIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodDelete, "/v1/pins/1", nil)
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+	})
 }
 
 func Test_pinComments(t *testing.T) {
 	assert := assert.New(t)
 
+	t.Run("NOT_FOUND", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		// A pin of another app
+		mock.ExpectQuery("SELECT id FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/pins/1/comments", nil)
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusNotFound, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"nodes":[],"error":{"code":"NOT_FOUND"}}`, string(body))
+	})
+
 	t.Run("empty", func(t *testing.T) {
 		db, mock := db.New()
 		h := New(db, nil)
 		m := middleware.New()
 
+		mock.ExpectQuery("SELECT id FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 		mock.ExpectQuery("SELECT .+ FROM comments").
 			WithArgs("1").
 			WillReturnRows(&sqlmock.Rows{})
@@ -249,6 +782,10 @@ func Test_pinComments(t *testing.T) {
 
 		mock.MatchExpectationsInOrder(false)
 
+		mock.ExpectQuery("SELECT id FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 		mock.ExpectQuery("SELECT .+ FROM comments").
 			WithArgs("1").
 			WillReturnRows(
@@ -264,6 +801,10 @@ func Test_pinComments(t *testing.T) {
 			WithArgs(1).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "comment_id"}))
 
+		mock.ExpectQuery("SELECT .+ FROM comment_reactions").
+			WithArgs(m.UserIDValue, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"comment_id", "emoji", "count", "reacted"}))
+
 		app := fiber.New()
 		h.Register(app, m)
 
@@ -274,7 +815,7 @@ func Test_pinComments(t *testing.T) {
 		assert.Equal(fiber.StatusOK, resp.StatusCode)
 		assert.Equal("1", resp.Header.Get("X-Total-Count"))
 		body, _ := io.ReadAll(resp.Body)
-		assert.Equal(`{"nodes":[{"id":1,"user":{"id":1,"name":"User 1"},"text":"Test","attachments":[],"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}],"error":null}`, string(body))
+		assert.Equal(`{"nodes":[{"id":1,"user":{"id":1,"name":"User 1"},"text":"Test","attachments":[],"reactions":[],"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}],"error":null}`, string(body))
 	})
 }
 
@@ -287,12 +828,24 @@ func Test_createComment(t *testing.T) {
 	h := New(db, storage)
 	m := middleware.New()
 
+	mock.ExpectQuery("SELECT id FROM pins").
+		WithArgs("1", m.AppIDValue).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 	mock.ExpectBegin()
 
 	mock.ExpectQuery("INSERT INTO comments").
 		WithArgs("1", m.UserIDValue, "Test").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
+	mock.ExpectExec("INSERT INTO thread_reads").
+		WithArgs(m.UserIDValue, "1", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec("INSERT INTO pin_subscriptions").
+		WithArgs("1", m.UserIDValue, m.AppIDValue).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
 	mock.ExpectExec("INSERT INTO attachments").
 		WithArgs(int64(1), sqlmock.AnyArg(), fmt.Sprintf(`{"hash":"%s","type":"image/png"}`, hash)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
@@ -322,3 +875,39 @@ func Test_createComment(t *testing.T) {
 	body, _ := io.ReadAll(resp.Body)
 	assert.Equal(t, `{"comment":{"id":1},"error":null}`, string(body))
 }
+
+func Test_createComment_notFound(t *testing.T) {
+	db, mock := db.New()
+	storage := storage.New()
+	h := New(db, storage)
+	m := middleware.New()
+
+	// A pin of another app
+	mock.ExpectQuery("SELECT id FROM pins").
+		WithArgs("1", m.AppIDValue).
+		WillReturnRows(&sqlmock.Rows{})
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+
+	text, _ := writer.CreateFormField("text")
+	text.Write([]byte("Test"))
+
+	attachment1 := testutil.CreateFormFile(writer, "attachments", "a.png", "image/png")
+	png.Encode(attachment1, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	writer.Close()
+
+	req := httptest.NewRequest(fiber.MethodPost, "/v1/pins/1/comments", buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 0, storage.UploadN)
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"comment":null,"error":{"code":"NOT_FOUND"}}`, string(body))
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/handler/body"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/settings"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func (h *Handler) updatePinPosition(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	r := role(c)
+	if !policy.Can(r, policy.MovePin) && !policy.Can(r, policy.MoveAnyPin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	// Same as createPin
+	var data struct {
+		Path  string  `json:"_path" form:"_path" validate:"trim,required"`
+		Path2 string  `json:"path" form:"path" validate:"trim,required"`
+		W     float64 `json:"w" form:"w" validate:"number,required"`
+		X     float64 `json:"_x" form:"_x" validate:"number,required"`
+		X2    float64 `json:"x" form:"x" validate:"number,required"`
+		Y     float64 `json:"_y" form:"_y" validate:"number,required"`
+		Y2    float64 `json:"y" form:"y" validate:"number,required"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	s, err := settings.Get(c.UserContext(), h.db, c.Locals(constant.AppIDKey).(string))
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	data.Path = s.Paths.Normalize(data.Path)
+
+	userID := c.Locals(constant.UserIDKey)
+
+	tx := h.db.MustBeginTx(c.UserContext(), nil)
+	defer tx.Rollback()
+
+	// The current position is kept before it's replaced, which also tells us
+	// whether the pin can be moved at all
+	res, err := tx.ExecContext(c.UserContext(), `
+		INSERT INTO pin_positions (pin_id, user_id, _path, path, w, _x, x, _y, y)
+		SELECT id, ?, _path, path, w, _x, x, _y, y
+		FROM pins
+		WHERE id = ?
+		  AND app_id = ?
+		  AND CASE WHEN ? THEN TRUE ELSE user_id = ? END
+	`, userID, c.Params("pinId"), c.Locals(constant.AppIDKey), policy.Can(r, policy.MoveAnyPin), userID)
+	if err != nil {
+		log.Error().Err(err).Msg("position.updatePinPosition")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	_, err = tx.ExecContext(c.UserContext(), `
+		UPDATE pins
+		SET _path = ?, path = ?, w = ?, _x = ?, x = ?, _y = ?, y = ?, detached_at = NULL
+		WHERE id = ?
+	`, data.Path, data.Path2, data.W, data.X, data.X2, data.Y, data.Y2, c.Params("pinId"))
+	if err != nil {
+		log.Error().Err(err).Msg("position.updatePinPosition")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("position.updatePinPosition")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) pinPositions(c *fiber.Ctx) error {
+	var result struct {
+		Nodes []*model.PinPosition `json:"nodes"`
+		Error any                  `json:"error"`
+	}
+	result.Nodes = []*model.PinPosition{}
+
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	rows, err := h.db.QueryxContext(c.UserContext(), `
+		SELECT pp.id, pp.user_id, pp.path, pp.w, pp._x, pp.x, pp._y, pp.y, pp.created_at
+		FROM pin_positions pp
+		JOIN pins p ON p.id = pp.pin_id
+		WHERE pp.pin_id = ?
+		  AND p.app_id = ?
+		ORDER BY pp.id ASC
+	`, c.Params("pinId"), c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("position.pinPositions")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	defer rows.Close()
+
+	var userIds []int
+	for rows.Next() {
+		var node model.PinPosition
+		if err := rows.StructScan(&node); err != nil {
+			log.Error().Err(err).Msg("position.pinPositions")
+			result.Error = errs.ErrInternalServerError
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+		userIds = append(userIds, node.UserID)
+		result.Nodes = append(result.Nodes, &node)
+	}
+	c.Set("X-Total-Count", strconv.Itoa(len(result.Nodes)))
+
+	if len(result.Nodes) == 0 {
+		return c.Status(fiber.StatusOK).JSON(result)
+	}
+
+	m, err := h.getUsers(c.UserContext(), userIds)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	for _, node := range result.Nodes {
+		node.User = m[node.UserID]
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// detachPin flags a pin whose anchor can't be found on the page anymore. Members
+// can flag any pin since anyone can notice it, moving it clears the flag.
+func (h *Handler) detachPin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.FlagPin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	// See assignPin for the no-op update
+	res, err := h.db.ExecContext(c.UserContext(), `
+		UPDATE pins
+		SET detached_at = COALESCE(detached_at, CURRENT_TIMESTAMP)
+		WHERE id = ?
+		  AND app_id = ?
+	`, c.Params("pinId"), c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("position.detachPin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// attachPin clears the flag set by detachPin, for anchors that show up again
+func (h *Handler) attachPin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.FlagPin) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	res, err := h.db.ExecContext(c.UserContext(), `
+		UPDATE pins
+		SET detached_at = NULL
+		WHERE id = ?
+		  AND app_id = ?
+	`, c.Params("pinId"), c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("position.attachPin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_updatePinPosition(t *testing.T) {
+	assert := assert.New(t)
+
+	body := `{"_path":" /About/ ","path":" main ","w":1080,"_x":10,"x":20,"_y":30,"y":40}`
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("viewer")
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/pins/1/position", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("BAD_REQUEST", func(t *testing.T) {
+		h := New(nil, nil)
+
+		app := fiber.New()
+		h.Register(app, middleware.New())
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/pins/1/position", strings.NewReader(`{"_path":"/about","path":"main"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		b, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":false,"error":{"_x":"INVALID","_y":"INVALID","w":"INVALID","x":"INVALID","y":"INVALID"}}`, string(b))
+	})
+
+	t.Run("NOT_FOUND", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO pin_positions").
+			WithArgs(m.UserIDValue, "1", m.AppIDValue, false, m.UserIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/pins/1/position", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("moderator")
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"paths":{"lowercase":true,"trim_trailing_slash":true}}`))
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO pin_positions").
+			WithArgs(m.UserIDValue, "1", m.AppIDValue, true, m.UserIDValue).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE pins").
+			WithArgs("/about", "main", 1080.0, 10.0, 20.0, 30.0, 40.0, "1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/pins/1/position", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		b, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(b))
+	})
+}
+
+func Test_pinPositions(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+
+	mock.ExpectQuery("SELECT .+ FROM pin_positions").
+		WithArgs("1", m.AppIDValue).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "user_id", "path", "w", "_x", "x", "_y", "y", "created_at"}).
+				AddRow(1, 1, "body", 1080, 10, 20, 30, 40, "2024-01-01 00:00:00"),
+		)
+
+	mock.ExpectQuery("SELECT .+ FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1"))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/v1/pins/1/positions", nil)
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Total-Count"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"nodes":[{"id":1,"user":{"id":1,"name":"User 1"},"path":"body","w":1080,"_x":10,"x":20,"_y":30,"y":40,"created_at":"2024-01-01T00:00:00Z"}],"error":null}`, string(body))
+}
+
+func Test_detachPin(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("viewer")
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/pins/1/detached", nil)
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("NOT_FOUND", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectExec("UPDATE pins SET detached_at").
+			WithArgs("1", m.AppIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/pins/1/detached", nil)
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectExec("UPDATE pins SET detached_at").
+			WithArgs("1", m.AppIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/pins/1/detached", nil)
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+}
+
+func Test_attachPin(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+
+	mock.ExpectExec("UPDATE pins SET detached_at = NULL").
+		WithArgs("1", m.AppIDValue).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodDelete, "/v1/pins/1/detached", nil)
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"success":true,"error":null}`, string(body))
+}
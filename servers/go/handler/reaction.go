@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/handler/body"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/tracing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+func (h *Handler) getReactions(ctx context.Context, commentIds []int, userID any) (map[int][]*model.Reaction, error) {
+	ctx, span := tracing.Start(ctx, "reaction.getReactions")
+	defer span.End()
+
+	if len(commentIds) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT comment_id, emoji, COUNT(user_id) AS count, MAX(user_id = ?) AS reacted
+		FROM comment_reactions
+		WHERE comment_id IN (?)
+		GROUP BY comment_id, emoji
+		ORDER BY MIN(created_at) ASC
+	`, userID, commentIds)
+	if err != nil {
+		log.Error().Err(err).Msg("reaction.getReactions")
+		return nil, errs.ErrInternalServerError
+	}
+
+	rows, err := h.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("reaction.getReactions")
+		return nil, errs.ErrInternalServerError
+	}
+	defer rows.Close()
+
+	m := make(map[int][]*model.Reaction, len(commentIds))
+	for rows.Next() {
+		var node model.Reaction
+		if err := rows.StructScan(&node); err != nil {
+			log.Error().Err(err).Msg("reaction.getReactions")
+			return nil, errs.ErrInternalServerError
+		}
+		m[node.CommentID] = append(m[node.CommentID], &node)
+	}
+
+	return m, nil
+}
+
+func (h *Handler) createReaction(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.ReactToComment) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	var data struct {
+		Emoji string `json:"emoji" validate:"trim,required,max=32"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	// See assignPin for the no-op update
+	res, err := h.db.ExecContext(c.UserContext(), `
+		INSERT INTO comment_reactions (comment_id, user_id, emoji)
+		SELECT c.id, ?, ?
+		FROM comments c
+		JOIN pins p ON p.id = c.pin_id
+		WHERE c.id = ?
+		  AND p.app_id = ?
+		ON CONFLICT (comment_id, user_id, emoji) DO UPDATE SET emoji = EXCLUDED.emoji
+	`, c.Locals(constant.UserIDKey), data.Emoji, c.Params("commentId"), c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("reaction.createReaction")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) deleteReaction(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.ReactToComment) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	var data struct {
+		Emoji string `json:"emoji" validate:"trim,required,max=32"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	_, err := h.db.ExecContext(c.UserContext(), `
+		DELETE FROM comment_reactions
+		WHERE comment_id = ?
+		  AND user_id = ?
+		  AND emoji = ?
+	`, c.Params("commentId"), c.Locals(constant.UserIDKey), data.Emoji)
+	if err != nil {
+		log.Error().Err(err).Msg("reaction.deleteReaction")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
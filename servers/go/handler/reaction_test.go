@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_createReaction(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectExec("INSERT INTO comment_reactions").
+			WithArgs(m.UserIDValue, "+1", "1", m.AppIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/comments/1/reactions", strings.NewReader(`{"emoji":" +1 "}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+
+	t.Run("NOT_FOUND", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectExec("INSERT INTO comment_reactions").
+			WithArgs(m.UserIDValue, "+1", "1", m.AppIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/comments/1/reactions", strings.NewReader(`{"emoji":"+1"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("viewer")
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/comments/1/reactions", strings.NewReader(`{"emoji":"+1"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func Test_deleteReaction(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+
+	mock.ExpectExec("DELETE FROM comment_reactions").
+		WithArgs("1", m.UserIDValue, "+1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodDelete, "/v1/comments/1/reactions", strings.NewReader(`{"emoji":"+1"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"success":true,"error":null}`, string(body))
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/policy"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+// markRead records commentID as the last comment the user has seen on the pin,
+// unless they have already seen a newer one.
+func markRead(ctx context.Context, db sqlx.ExecerContext, userID, pinID any, commentID int) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO thread_reads (user_id, pin_id, comment_id)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id, pin_id) DO UPDATE
+		SET comment_id = MAX(comment_id, EXCLUDED.comment_id),
+		    updated_at = CURRENT_TIMESTAMP
+	`, userID, pinID, commentID)
+	if err != nil {
+		log.Error().Err(err).Msg("read.markRead")
+		return errs.ErrInternalServerError
+	}
+	return nil
+}
+
+func (h *Handler) readPin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	res, err := h.db.ExecContext(c.UserContext(), `
+		INSERT INTO thread_reads (user_id, pin_id, comment_id)
+		SELECT ?, p.id, MAX(c.id)
+		FROM pins p
+		JOIN comments c ON c.pin_id = p.id
+		WHERE p.id = ?
+		  AND p.app_id = ?
+		GROUP BY p.id
+		ON CONFLICT (user_id, pin_id) DO UPDATE
+		SET comment_id = MAX(comment_id, EXCLUDED.comment_id),
+		    updated_at = CURRENT_TIMESTAMP
+	`, c.Locals(constant.UserIDKey), c.Params("pinId"), c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("read.readPin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
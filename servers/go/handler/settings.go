@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/handler/body"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/settings"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) settings(c *fiber.Ctx) error {
+	var result struct {
+		Settings *model.Settings `json:"settings"`
+		Error    any             `json:"error"`
+	}
+
+	s, err := settings.Get(c.UserContext(), h.db, c.Locals(constant.AppIDKey).(string))
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	result.Settings = s
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) updateSettings(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.UpdateSettings) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	var data model.Settings
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	appID := c.Locals(constant.AppIDKey).(string)
+
+	s, err := settings.Get(c.UserContext(), h.db, appID)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	// The current transitions would point to statuses that might not exist anymore
+	if data.Statuses != nil && data.Transitions == nil {
+		data.Transitions = settings.Transitions(data.Statuses)
+	}
+
+	// Only the fields in the body are replaced
+	settings.Fill(&data, s)
+
+	if err := settings.Validate(&data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	if err := settings.Save(c.UserContext(), h.db, appID, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_settings(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+
+	mock.ExpectQuery("SELECT settings FROM apps").
+		WithArgs(m.AppIDValue).
+		WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"statuses":[{"key":"new","name":"New"},{"key":"done","name":"Done","closed":true}],"transitions":{"new":["done"]}}`))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/v1/settings", nil)
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"settings":{"statuses":[{"key":"new","name":"New","closed":false},{"key":"done","name":"Done","closed":true}],"transitions":{"new":["done"]},"paths":{"lowercase":false,"trim_trailing_slash":false,"rewrites":[]},"versions":{"carry_open":true},"breakpoints":[]},"error":null}`, string(body))
+}
+
+func Test_updateSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/settings", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":false,"error":{"code":"FORBIDDEN"}}`, string(body))
+	})
+
+	t.Run("INVALID", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/settings", strings.NewReader(`{"statuses":[{"key":"new","name":"New"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Contains(string(body), `"statuses":"INVALID"`)
+	})
+
+	t.Run("statuses only", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectExec("INSERT INTO apps").
+			WithArgs(m.AppIDValue, `{"statuses":[{"key":"new","name":"New","closed":false},{"key":"doing","name":"Doing","closed":false},{"key":"done","name":"Done","closed":true}],"transitions":{"doing":["new","done"],"done":["new","doing"],"new":["doing","done"]},"paths":{"lowercase":false,"trim_trailing_slash":false,"rewrites":[]},"versions":{"carry_open":true},"breakpoints":[]}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/settings", strings.NewReader(`{"statuses":[{"key":"new","name":"New"},{"key":"doing","name":"Doing"},{"key":"done","name":"Done","closed":true}]}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectExec("INSERT INTO apps").
+			WithArgs(m.AppIDValue, `{"statuses":[{"key":"new","name":"New","closed":false},{"key":"done","name":"Done","closed":true}],"transitions":{"done":["new"],"new":["done"]},"paths":{"lowercase":false,"trim_trailing_slash":true,"rewrites":[{"pattern":"^/products/[^/]+","replacement":"/products/:id"}]},"versions":{"carry_open":false},"breakpoints":[640,1024]}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/settings", strings.NewReader(`{"statuses":[{"key":"new","name":" New "},{"key":"done","name":"Done","closed":true}],"transitions":{"new":["done"],"done":["new"]},"paths":{"trim_trailing_slash":true,"rewrites":[{"pattern":"^/products/[^/]+","replacement":"/products/:id"}]},"versions":{"carry_open":false},"breakpoints":[640,1024]}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/handler/body"
+	"github.com/brantem/aloy/metrics"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/settings"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// changePinStatus moves a pin to the status returned by pick and records the
+// change. It returns the HTTP status code to respond with.
+func (h *Handler) changePinStatus(c *fiber.Ctx, pick func(s *model.Settings, current *model.Status) string) (int, error) {
+	appID := c.Locals(constant.AppIDKey).(string)
+	userID := c.Locals(constant.UserIDKey)
+
+	tx := h.db.MustBeginTx(c.UserContext(), nil)
+	defer tx.Rollback()
+
+	// Read in the transaction so the transition is checked against the settings
+	// the status is written with
+	s, err := settings.Get(c.UserContext(), tx, appID)
+	if err != nil {
+		return fiber.StatusInternalServerError, err
+	}
+
+	var pin struct {
+		UserID int    `db:"user_id"`
+		Status string `db:"status"`
+	}
+	err = tx.QueryRowxContext(c.UserContext(), `
+		SELECT user_id, status
+		FROM pins
+		WHERE id = ?
+		  AND app_id = ?
+	`, c.Params("pinId"), appID).StructScan(&pin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fiber.StatusNotFound, errs.ErrNotFound
+		}
+		log.Error().Err(err).Msg("status.changePinStatus")
+		return fiber.StatusInternalServerError, errs.ErrInternalServerError
+	}
+
+	from := s.Status(pin.Status)
+	to := s.Status(pick(s, from))
+	if to == nil {
+		return fiber.StatusBadRequest, errs.MapErrors{"status": errs.ErrInvalid}
+	}
+	if to.Key == pin.Status {
+		return fiber.StatusOK, nil
+	}
+
+	isClosed := from != nil && from.Closed
+
+	own, all := policy.UpdatePinStatus, policy.UpdateAnyPinStatus
+	if to.Closed && !isClosed {
+		own, all = policy.CompletePin, policy.CompleteAnyPin
+	} else if !to.Closed && isClosed {
+		own, all = policy.ReopenPin, policy.ReopenAnyPin
+	}
+
+	r := role(c)
+	isOwner := strconv.Itoa(pin.UserID) == userID
+	if !policy.Can(r, all) && !(isOwner && policy.Can(r, own)) {
+		return fiber.StatusForbidden, errs.ErrForbidden
+	}
+
+	if !s.CanTransition(pin.Status, to.Key) {
+		return fiber.StatusBadRequest, errs.MapErrors{"status": settings.ErrInvalidTransition}
+	}
+
+	_, err = tx.ExecContext(c.UserContext(), `
+		UPDATE pins
+		SET status = ?,
+		    completed_at = CASE WHEN ? THEN COALESCE(completed_at, CURRENT_TIMESTAMP) ELSE NULL END,
+		    completed_by_id = CASE WHEN ? THEN COALESCE(completed_by_id, ?) ELSE NULL END
+		WHERE id = ?
+	`, to.Key, to.Closed, to.Closed, userID, c.Params("pinId"))
+	if err != nil {
+		log.Error().Err(err).Msg("status.changePinStatus")
+		return fiber.StatusInternalServerError, errs.ErrInternalServerError
+	}
+
+	_, err = tx.ExecContext(c.UserContext(), `
+		INSERT INTO pin_statuses (pin_id, user_id, from_status, to_status)
+		VALUES (?, ?, ?, ?)
+	`, c.Params("pinId"), userID, pin.Status, to.Key)
+	if err != nil {
+		log.Error().Err(err).Msg("status.changePinStatus")
+		return fiber.StatusInternalServerError, errs.ErrInternalServerError
+	}
+
+	if err := h.notify(c.UserContext(), tx, NotificationStatus, c.Params("pinId"), userID, nil, to.Name, nil); err != nil {
+		return fiber.StatusInternalServerError, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("status.changePinStatus")
+		return fiber.StatusInternalServerError, errs.ErrInternalServerError
+	}
+
+	if to.Closed && !isClosed {
+		metrics.PinsCompleted.WithLabelValues(metrics.App(appID)).Inc()
+	}
+
+	return fiber.StatusOK, nil
+}
+
+func (h *Handler) updatePinStatus(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	var data struct {
+		Status string `json:"status" validate:"trim,required"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	status, err := h.changePinStatus(c, func(*model.Settings, *model.Status) string {
+		return data.Status
+	})
+	if err != nil {
+		result.Error = err
+		return c.Status(status).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) pinStatuses(c *fiber.Ctx) error {
+	var result struct {
+		Nodes []*model.PinStatus `json:"nodes"`
+		Error any                `json:"error"`
+	}
+	result.Nodes = []*model.PinStatus{}
+
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	rows, err := h.db.QueryxContext(c.UserContext(), `
+		SELECT s.id, s.user_id, s.from_status, s.to_status, s.created_at
+		FROM pin_statuses s
+		JOIN pins p ON p.id = s.pin_id
+		WHERE s.pin_id = ?
+		  AND p.app_id = ?
+		ORDER BY s.id ASC
+	`, c.Params("pinId"), c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("status.pinStatuses")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	defer rows.Close()
+
+	var userIds []int
+	for rows.Next() {
+		var node model.PinStatus
+		if err := rows.StructScan(&node); err != nil {
+			log.Error().Err(err).Msg("status.pinStatuses")
+			result.Error = errs.ErrInternalServerError
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+		userIds = append(userIds, node.UserID)
+		result.Nodes = append(result.Nodes, &node)
+	}
+	c.Set("X-Total-Count", strconv.Itoa(len(result.Nodes)))
+
+	if len(result.Nodes) == 0 {
+		return c.Status(fiber.StatusOK).JSON(result)
+	}
+
+	m, err := h.getUsers(c.UserContext(), userIds)
+	if err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	for _, node := range result.Nodes {
+		node.User = m[node.UserID]
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_updatePinStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.UserIDValue = testutil.Ptr("1")
+
+		mock.ExpectBegin()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectQuery("SELECT user_id, status FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(1, "open"))
+
+		mock.ExpectExec("UPDATE pins SET status").
+			WithArgs("in_progress", false, false, m.UserIDValue, "1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectExec("INSERT INTO pin_statuses").
+			WithArgs("1", m.UserIDValue, "open", "in_progress").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		mock.ExpectCommit()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/pins/1/status", strings.NewReader(`{"status":" in_progress "}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+
+	t.Run("INVALID_TRANSITION", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.UserIDValue = testutil.Ptr("1")
+
+		mock.ExpectBegin()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectQuery("SELECT user_id, status FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(1, "resolved"))
+
+		mock.ExpectRollback()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/pins/1/status", strings.NewReader(`{"status":"wont_fix"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":false,"error":{"status":"INVALID_TRANSITION"}}`, string(body))
+	})
+
+	t.Run("INVALID", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectBegin()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs(m.AppIDValue).
+			WillReturnRows(&sqlmock.Rows{})
+
+		mock.ExpectQuery("SELECT user_id, status FROM pins").
+			WithArgs("1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(1, "open"))
+
+		mock.ExpectRollback()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPatch, "/v1/pins/1/status", strings.NewReader(`{"status":"abc"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":false,"error":{"status":"INVALID"}}`, string(body))
+	})
+}
+
+func Test_pinStatuses(t *testing.T) {
+	db, mock := db.New()
+	h := New(db, nil)
+	m := middleware.New()
+
+	mock.ExpectQuery("SELECT .+ FROM pin_statuses").
+		WithArgs("1", m.AppIDValue).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "user_id", "from_status", "to_status", "created_at"}).
+				AddRow(1, 1, "open", "resolved", "2024-01-01 00:00:00"),
+		)
+
+	mock.ExpectQuery("SELECT .+ FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1"))
+
+	app := fiber.New()
+	h.Register(app, m)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/v1/pins/1/statuses", nil)
+
+	resp, _ := app.Test(req)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Total-Count"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"nodes":[{"id":1,"user":{"id":1,"name":"User 1"},"from":"open","to":"resolved","created_at":"2024-01-01T00:00:00Z"}],"error":null}`, string(body))
+}
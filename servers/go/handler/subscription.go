@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/policy"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+// subscribe makes the users watch the pin, ids that don't belong to a user of
+// the app are ignored.
+func subscribe(ctx context.Context, db sqlx.ExecerContext, appID, pinID any, userIds []any) error {
+	query, args, err := sqlx.In(`
+		INSERT INTO pin_subscriptions (pin_id, user_id)
+		SELECT ?, id
+		FROM users
+		WHERE id IN (?)
+		  AND app_id = ?
+		ON CONFLICT (pin_id, user_id) DO NOTHING
+	`, pinID, userIds, appID)
+	if err != nil {
+		log.Error().Err(err).Msg("subscription.subscribe")
+		return errs.ErrInternalServerError
+	}
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		log.Error().Err(err).Msg("subscription.subscribe")
+		return errs.ErrInternalServerError
+	}
+
+	return nil
+}
+
+func (h *Handler) subscribePin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	// See assignPin for the no-op update
+	res, err := h.db.ExecContext(c.UserContext(), `
+		INSERT INTO pin_subscriptions (pin_id, user_id)
+		SELECT id, ?
+		FROM pins
+		WHERE id = ?
+		  AND app_id = ?
+		ON CONFLICT (pin_id, user_id) DO UPDATE SET pin_id = EXCLUDED.pin_id
+	`, c.Locals(constant.UserIDKey), c.Params("pinId"), c.Locals(constant.AppIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("subscription.subscribePin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) unsubscribePin(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	_, err := h.db.ExecContext(c.UserContext(), `
+		DELETE FROM pin_subscriptions
+		WHERE pin_id = ?
+		  AND user_id = ?
+	`, c.Params("pinId"), c.Locals(constant.UserIDKey))
+	if err != nil {
+		log.Error().Err(err).Msg("subscription.unsubscribePin")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
@@ -2,22 +2,42 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/brantem/aloy/constant"
 	"github.com/brantem/aloy/errs"
 	"github.com/brantem/aloy/handler/body"
 	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/policy"
+	"github.com/brantem/aloy/storage"
+	"github.com/brantem/aloy/tracing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
 )
 
+// metadataMaxSize is the most bytes of JSON a user's metadata can take
+const metadataMaxSize = 4 * 1024
+
 func (h *Handler) getUsers(ctx context.Context, userIds []int) (map[int]*model.User, error) {
+	ctx, span := tracing.Start(ctx, "user.getUsers")
+	defer span.End()
+
 	if len(userIds) == 0 {
 		return nil, nil
 	}
 
-	query, args, err := sqlx.In(`SELECT id, name FROM users WHERE id IN (?)`, userIds)
+	query, args, err := sqlx.In(`SELECT id, name, avatar_url, metadata FROM users WHERE id IN (?)`, userIds)
 	if err != nil {
 		log.Error().Err(err).Msg("user.getUsers")
 		return nil, errs.ErrInternalServerError
@@ -43,6 +63,176 @@ func (h *Handler) getUsers(ctx context.Context, userIds []int) (map[int]*model.U
 	return m, nil
 }
 
+func (h *Handler) users(c *fiber.Ctx) error {
+	var result struct {
+		Nodes []*model.User `json:"nodes"`
+		Error any           `json:"error"`
+	}
+	result.Nodes = []*model.User{}
+
+	if !policy.Can(role(c), policy.ReadPins) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	limit := min(max(c.QueryInt("limit", 10), 1), 50)
+
+	// Matches the start of any word so "doe" finds "John Doe"
+	q := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.TrimSpace(c.Query("q")))
+
+	// Emails are only shown to admins, and to the users themselves
+	userID := c.Locals(constant.UserIDKey)
+	err := h.db.SelectContext(c.UserContext(), &result.Nodes, `
+		SELECT id, name, CASE WHEN ? OR id = ? THEN email END AS email, avatar_url, metadata
+		FROM users
+		WHERE app_id = ?
+		  AND (name LIKE ? || '%' ESCAPE '\' OR name LIKE '% ' || ? || '%' ESCAPE '\')
+		ORDER BY name ASC, id ASC
+		LIMIT ?
+	`, policy.Can(role(c), policy.ReadEmails), userID, c.Locals(constant.AppIDKey), q, q, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("user.users")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	c.Set("X-Total-Count", strconv.Itoa(len(result.Nodes)))
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) me(c *fiber.Ctx) error {
+	type User struct {
+		model.User
+		Role          string `json:"role"`
+		Notifications string `json:"notifications"`
+	}
+
+	var result struct {
+		User  *User `json:"user"`
+		Error any   `json:"error"`
+	}
+
+	var user User
+	err := h.db.QueryRowxContext(c.UserContext(), `
+		SELECT id, name, email, avatar_url, metadata, role, notifications
+		FROM users
+		WHERE id = ?
+	`, c.Locals(constant.UserIDKey)).StructScan(&user)
+	if err != nil {
+		log.Error().Err(err).Msg("user.me")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	result.User = &user
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// userData is a user as their app knows it, synced with syncUser
+type userData struct {
+	ID        string         `json:"id" validate:"trim,required"`
+	Name      string         `json:"name" validate:"trim,required"`
+	Email     string         `json:"email" validate:"trim,omitempty,email"`
+	AvatarURL string         `json:"avatar_url" validate:"trim,omitempty,http_url"`
+	Metadata  map[string]any `json:"metadata"`
+}
+
+// metadata returns the user's metadata as stored, or nil when it was left out
+func (u *userData) metadata() (*string, error) {
+	if u.Metadata == nil {
+		return nil, nil
+	}
+
+	buf, _ := json.Marshal(u.Metadata)
+	if len(buf) > metadataMaxSize {
+		return nil, errs.MapErrors{"metadata": errs.NewCodeError("TOO_BIG")}
+	}
+	s := string(buf)
+	return &s, nil
+}
+
+// syncUser creates the user or updates their profile, and returns their id.
+// Fields that are left out keep their current value. Unlike an upsert, nothing
+// is written when nothing changed, since every INSERT attempt (even one that
+// ends up doing nothing) uses up a value of the id sequence.
+func (h *Handler) syncUser(ctx context.Context, db sqlx.ExtContext, appID any, u *userData) (int, error) {
+	ctx, span := tracing.Start(ctx, "user.syncUser")
+	defer span.End()
+
+	metadata, err := u.metadata()
+	if err != nil {
+		return 0, err
+	}
+
+	var current struct {
+		ID        int     `db:"id"`
+		Name      string  `db:"name"`
+		Email     *string `db:"email"`
+		AvatarURL *string `db:"avatar_url"`
+		Metadata  *string `db:"metadata"`
+	}
+	err = sqlx.GetContext(ctx, db, &current, `
+		SELECT id, name, email, avatar_url, metadata
+		FROM users
+		WHERE _id = ?
+		  AND app_id = ?
+	`, u.ID, appID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Err(err).Msg("user.syncUser")
+		return 0, errs.ErrInternalServerError
+	}
+
+	if err == nil {
+		changed := func(current *string, v string) bool { return v != "" && (current == nil || *current != v) }
+		if u.Name == current.Name && !changed(current.Email, u.Email) && !changed(current.AvatarURL, u.AvatarURL) && (metadata == nil || !changed(current.Metadata, *metadata)) {
+			return current.ID, nil
+		}
+
+		_, err := db.ExecContext(ctx, `
+			UPDATE users
+			SET name = ?,
+			    email = COALESCE(NULLIF(?, ''), email),
+			    avatar_url = COALESCE(NULLIF(?, ''), avatar_url),
+			    metadata = COALESCE(?, metadata)
+			WHERE id = ?
+		`, u.Name, u.Email, u.AvatarURL, metadata, current.ID)
+		if err != nil {
+			log.Error().Err(err).Msg("user.syncUser")
+			return 0, errs.ErrInternalServerError
+		}
+		return current.ID, nil
+	}
+
+	// New users are members, owners are only made by createUser with ADMIN_TOKEN
+	var id int
+	err = db.QueryRowxContext(ctx, `
+		INSERT INTO users (_id, app_id, name, email, avatar_url, metadata)
+		VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?)
+		ON CONFLICT (_id, app_id) DO NOTHING
+		RETURNING id
+	`, u.ID, appID, u.Name, u.Email, u.AvatarURL, metadata).Scan(&id)
+	if err == sql.ErrNoRows {
+		// Someone else created the user in the meantime
+		err = sqlx.GetContext(ctx, db, &id, `SELECT id FROM users WHERE _id = ? AND app_id = ?`, u.ID, appID)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("user.syncUser")
+		return 0, errs.ErrInternalServerError
+	}
+
+	return id, nil
+}
+
+// isAdmin reports whether the request is authenticated with ADMIN_TOKEN, which
+// is never the case when it isn't set
+func (h *Handler) isAdmin(c *fiber.Ctx) bool {
+	if h.config.adminToken == "" {
+		return false
+	}
+	v, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(v), []byte(h.config.adminToken)) == 1
+}
+
 func (h *Handler) createUser(c *fiber.Ctx) error {
 	type User struct {
 		ID int `json:"id"`
@@ -53,30 +243,214 @@ func (h *Handler) createUser(c *fiber.Ctx) error {
 		Error any   `json:"error"`
 	}
 
+	var data userData
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	id, err := h.syncUser(c.UserContext(), h.db, c.Locals(constant.AppIDKey), &data)
+	if err != nil {
+		result.Error = err
+		if _, ok := err.(errs.MapErrors); ok {
+			return c.Status(fiber.StatusBadRequest).JSON(result)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	// Every other request trusts whoever knows the app id, so the first owner of
+	// an app can only be made by the backend
+	if h.isAdmin(c) {
+		if _, err := h.db.ExecContext(c.UserContext(), `UPDATE users SET role = 'owner' WHERE id = ?`, id); err != nil {
+			log.Error().Err(err).Msg("user.createUser")
+			result.Error = errs.ErrInternalServerError
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+	}
+	result.User = &User{id}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) createUsers(c *fiber.Ctx) error {
+	type User struct {
+		ID         int    `json:"id"`
+		ExternalID string `json:"_id"`
+	}
+
+	var result struct {
+		Nodes []*User `json:"nodes"`
+		Error any     `json:"error"`
+	}
+	result.Nodes = []*User{}
+
 	var data struct {
-		ID   string `json:"id" validate:"trim,required"`
-		Name string `json:"name" validate:"trim,required"`
+		Users []*userData `json:"users" validate:"required,min=1,max=100,dive"`
 	}
 	if err := body.Parse(c, &data); err != nil {
 		result.Error = err
 		return c.Status(fiber.StatusBadRequest).JSON(result)
 	}
 
-	// FIXME: This upsert keeps incrementing the id sequence even when nothing changes
+	for _, u := range data.Users {
+		if _, err := u.metadata(); err != nil {
+			result.Error = err
+			return c.Status(fiber.StatusBadRequest).JSON(result)
+		}
+	}
 
-	var user User
-	err := h.db.QueryRowContext(c.UserContext(), `
-		INSERT INTO users (_id, app_id, name)
-		VALUES (?, ?, ?)
-		ON CONFLICT (_id, app_id) DO UPDATE SET name = EXCLUDED.name
-		RETURNING id
-	`, data.ID, c.Locals(constant.AppIDKey), data.Name).Scan(&user.ID)
+	tx := h.db.MustBeginTx(c.UserContext(), nil)
+	defer tx.Rollback()
+
+	appID := c.Locals(constant.AppIDKey)
+	for _, u := range data.Users {
+		id, err := h.syncUser(c.UserContext(), tx, appID, u)
+		if err != nil {
+			result.Error = err
+			return c.Status(fiber.StatusInternalServerError).JSON(result)
+		}
+		result.Nodes = append(result.Nodes, &User{id, u.ID})
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error().Err(err).Msg("user.createUsers")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) updateUserRole(c *fiber.Ctx) error {
+	var result struct {
+		Success bool `json:"success"`
+		Error   any  `json:"error"`
+	}
+
+	var data struct {
+		Role string `json:"role" validate:"trim,required,oneof=owner admin moderator member viewer"`
+	}
+	if err := body.Parse(c, &data); err != nil {
+		result.Error = err
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	r := role(c)
+	canUpdateOwner := policy.Can(r, policy.UpdateOwnerRole)
+	if !policy.Can(r, policy.UpdateRole) || (data.Role == string(policy.RoleOwner) && !canUpdateOwner) {
+		result.Error = errs.ErrForbidden
+		return c.Status(fiber.StatusForbidden).JSON(result)
+	}
+
+	// Users can't change their own role, so an app always keeps at least one owner
+	res, err := h.db.ExecContext(c.UserContext(), `
+		UPDATE users
+		SET role = ?
+		WHERE id = ?
+		  AND id != ?
+		  AND app_id = ?
+		  AND CASE WHEN ? THEN TRUE ELSE role != 'owner' END
+	`, data.Role, c.Params("userId"), c.Locals(constant.UserIDKey), c.Locals(constant.AppIDKey), canUpdateOwner)
+	if err != nil {
+		log.Error().Err(err).Msg("user.updateUserRole")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		result.Error = errs.ErrNotFound
+		return c.Status(fiber.StatusNotFound).JSON(result)
+	}
+
+	result.Success = true
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Handler) updateAvatar(c *fiber.Ctx) error {
+	type User struct {
+		AvatarURL string `json:"avatar_url"`
+	}
+
+	var result struct {
+		User  *User `json:"user"`
+		Error any   `json:"error"`
+	}
+
+	fh, err := c.FormFile("avatar")
 	if err != nil {
-		log.Error().Err(err).Msg("user.createUser")
+		result.Error = errs.MapErrors{"avatar": errs.ErrInvalid}
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	if fh.Size > int64(h.config.attachmentMaxSize) {
+		result.Error = errs.MapErrors{"avatar": errs.NewCodeError("TOO_BIG")}
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	_type := fh.Header.Get("Content-Type")
+	if !slices.Contains(h.config.attachmentSupportedTypes, _type) {
+		result.Error = errs.MapErrors{"avatar": errs.NewCodeError("UNSUPPORTED")}
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		log.Error().Err(err).Msg("user.updateAvatar")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+	defer file.Close()
+
+	if _, _, err := image.DecodeConfig(file); err != nil {
+		result.Error = errs.MapErrors{"avatar": errs.ErrInvalid}
+		return c.Status(fiber.StatusBadRequest).JSON(result)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Error().Err(err).Msg("user.updateAvatar")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	userID := c.Locals(constant.UserIDKey)
+
+	var old sql.NullString
+	if err := h.db.QueryRowContext(c.UserContext(), `SELECT avatar_url FROM users WHERE id = ?`, userID).Scan(&old); err != nil {
+		log.Error().Err(err).Msg("user.updateAvatar")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	opts := &storage.UploadOpts{
+		Key:           fmt.Sprintf("avatars/%d%s", time.Now().UnixMilli(), filepath.Ext(fh.Filename)),
+		Body:          file,
+		ContentType:   _type,
+		ContentLength: fh.Size,
+	}
+	if err := h.storage.Upload(c.UserContext(), opts); err != nil {
+		log.Error().Err(err).Msg("user.updateAvatar")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
+	user := User{fmt.Sprintf("%s/%s", h.config.assetsBaseURL, opts.Key)}
+	if _, err := h.db.ExecContext(c.UserContext(), `UPDATE users SET avatar_url = ? WHERE id = ?`, user.AvatarURL, userID); err != nil {
+		log.Error().Err(err).Msg("user.updateAvatar")
+		// Nothing points to the new avatar
+		if err := h.storage.DeleteMultiple(c.UserContext(), []string{opts.Key}); err != nil {
+			log.Error().Err(err).Msg("user.updateAvatar")
+		}
 		result.Error = errs.ErrInternalServerError
 		return c.Status(fiber.StatusInternalServerError).JSON(result)
 	}
 	result.User = &user
 
+	// Only avatars uploaded here are ours to delete, the rest are URLs passed to createUser
+	if key, ok := strings.CutPrefix(old.String, h.config.assetsBaseURL+"/"); ok && strings.HasPrefix(key, "avatars/") {
+		if err := h.storage.DeleteMultiple(c.UserContext(), []string{key}); err != nil {
+			log.Error().Err(err).Msg("user.updateAvatar")
+		}
+	}
+
 	return c.Status(fiber.StatusOK).JSON(result)
 }
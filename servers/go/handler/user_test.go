@@ -1,15 +1,24 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
 	"io"
+	"mime/multipart"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/testutil"
 	"github.com/brantem/aloy/testutil/db"
 	"github.com/brantem/aloy/testutil/middleware"
+	"github.com/brantem/aloy/testutil/storage"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 )
@@ -31,32 +40,448 @@ func Test_getUsers(t *testing.T) {
 
 		mock.ExpectQuery("SELECT .+ FROM users").
 			WithArgs(1).
-			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "User 1"))
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "avatar_url", "metadata"}).
+					AddRow(1, "User 1", "https://example.com/a.png", `{"team":"Design"}`),
+			)
 
 		m, err := h.getUsers(context.TODO(), []int{1})
-		assert.Equal(1, m[1].ID)
 		assert.Nil(err)
+		buf, _ := json.Marshal(m[1])
+		assert.Equal(`{"id":1,"name":"User 1","avatar_url":"https://example.com/a.png","metadata":{"team":"Design"}}`, string(buf))
 	})
 }
 
-func Test_createUser(t *testing.T) {
+func Test_users(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("")
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/users", nil)
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs(false, m.UserIDValue, m.AppIDValue, `jo\_`, `jo\_`, 50).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}).
+					AddRow(1, "jo_hn", nil, nil, nil),
+			)
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/users?q=jo_&limit=100", nil)
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		assert.Equal("1", resp.Header.Get("X-Total-Count"))
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"nodes":[{"id":1,"name":"jo_hn"}],"error":null}`, string(body))
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		mock.ExpectQuery("SELECT id, name, CASE WHEN \\? OR id = \\? THEN email END AS email, .+ FROM users").
+			WithArgs(true, m.UserIDValue, m.AppIDValue, "", "", 10).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}).
+					AddRow(2, "User 2", "user2@example.com", nil, nil),
+			)
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/users", nil)
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"nodes":[{"id":2,"name":"User 2","email":"user2@example.com"}],"error":null}`, string(body))
+	})
+}
+
+func Test_me(t *testing.T) {
 	db, mock := db.New()
 	h := New(db, nil)
 	m := middleware.New()
 
-	mock.ExpectQuery("INSERT INTO users").
-		WithArgs("user-1", m.AppIDValue, "John Doe").
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT .+ FROM users").
+		WithArgs(m.UserIDValue).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata", "role", "notifications"}).
+				AddRow(1, "User 1", "user1@example.com", nil, nil, "member", "daily"),
+		)
 
 	app := fiber.New()
 	h.Register(app, m)
 
-	req := httptest.NewRequest(fiber.MethodPost, "/v1/users", strings.NewReader(`{"id":" user-1 ","name":" John Doe "}`))
-	req.Header.Set("Content-Type", "application/json")
-
+	req := httptest.NewRequest(fiber.MethodGet, "/v1/users/me", nil)
 	resp, _ := app.Test(req)
 	assert.Nil(t, mock.ExpectationsWereMet())
 	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
 	body, _ := io.ReadAll(resp.Body)
-	assert.Equal(t, `{"user":{"id":1},"error":null}`, string(body))
+	assert.Equal(t, `{"user":{"id":1,"name":"User 1","email":"user1@example.com","role":"member","notifications":"daily"},"error":null}`, string(body))
+}
+
+func Test_createUser(t *testing.T) {
+	assert := assert.New(t)
+
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/users", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("TOO_BIG", func(t *testing.T) {
+		h := New(nil, nil)
+
+		app := fiber.New()
+		h.Register(app, middleware.New())
+
+		resp, _ := app.Test(newRequest(`{"id":"user-1","name":"John Doe","metadata":{"a":"` + strings.Repeat("a", metadataMaxSize) + `"}}`))
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"user":null,"error":{"metadata":"TOO_BIG"}}`, string(body))
+	})
+
+	t.Run("new", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs("user-1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}))
+		mock.ExpectQuery("INSERT INTO users").
+			WithArgs("user-1", m.AppIDValue, "John Doe", "john@example.com", "https://example.com/a.png", `{"team":"Design"}`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		resp, _ := app.Test(newRequest(`{"id":" user-1 ","name":" John Doe ","email":" john@example.com ","avatar_url":"https://example.com/a.png","metadata":{"team":"Design"}}`))
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"user":{"id":1},"error":null}`, string(body))
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		t.Setenv("ADMIN_TOKEN", "secret")
+
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs("user-1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}))
+		mock.ExpectQuery("INSERT INTO users").
+			WithArgs("user-1", m.AppIDValue, "John Doe", "", "", nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec("UPDATE users SET role = 'owner'").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := newRequest(`{"id":"user-1","name":"John Doe"}`)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+
+		// Without the token, or with a wrong one, the user stays a member
+		for _, v := range []string{"", "Bearer wrong"} {
+			mock.ExpectQuery("SELECT .+ FROM users").
+				WithArgs("user-1", m.AppIDValue).
+				WillReturnRows(
+					sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}).
+						AddRow(1, "John Doe", nil, nil, nil),
+				)
+
+			req := newRequest(`{"id":"user-1","name":"John Doe"}`)
+			req.Header.Set("Authorization", v)
+			resp, _ := app.Test(req)
+			assert.Nil(mock.ExpectationsWereMet())
+			assert.Equal(fiber.StatusOK, resp.StatusCode)
+		}
+	})
+
+	t.Run("created in the meantime", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs("user-1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}))
+		mock.ExpectQuery("INSERT INTO users").
+			WithArgs("user-1", m.AppIDValue, "John Doe", "", "", nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT id FROM users").
+			WithArgs("user-1", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		resp, _ := app.Test(newRequest(`{"id":"user-1","name":"John Doe"}`))
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"user":{"id":1},"error":null}`, string(body))
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs("user-1", m.AppIDValue).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}).
+					AddRow(1, "John Doe", "john@example.com", nil, `{"team":"Design"}`),
+			)
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		// Left out fields keep their current value, so they aren't changes either
+		resp, _ := app.Test(newRequest(`{"id":"user-1","name":"John Doe","metadata":{"team":"Design"}}`))
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"user":{"id":1},"error":null}`, string(body))
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs("user-1", m.AppIDValue).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}).
+					AddRow(1, "John Doe", nil, nil, nil),
+			)
+		mock.ExpectExec("UPDATE users").
+			WithArgs("John Doe", "john@example.com", "", nil, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		resp, _ := app.Test(newRequest(`{"id":"user-1","name":"John Doe","email":"john@example.com"}`))
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"user":{"id":1},"error":null}`, string(body))
+	})
+}
+
+func Test_createUsers(t *testing.T) {
+	assert := assert.New(t)
+
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/users:batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("BAD_REQUEST", func(t *testing.T) {
+		h := New(nil, nil)
+
+		app := fiber.New()
+		h.Register(app, middleware.New())
+
+		resp, _ := app.Test(newRequest(`{"users":[{"id":"user-1"}]}`))
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"nodes":[],"error":{"name":"INVALID"}}`, string(body))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs("user-1", m.AppIDValue).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}).
+					AddRow(1, "User 1", nil, nil, nil),
+			)
+		mock.ExpectQuery("SELECT .+ FROM users").
+			WithArgs("user-2", m.AppIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "avatar_url", "metadata"}))
+		mock.ExpectQuery("INSERT INTO users").
+			WithArgs("user-2", m.AppIDValue, "User 2", "", "", nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectCommit()
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		resp, _ := app.Test(newRequest(`{"users":[{"id":"user-1","name":"User 1"},{"id":"user-2","name":"User 2"}]}`))
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"nodes":[{"id":1,"_id":"user-1"},{"id":2,"_id":"user-2"}],"error":null}`, string(body))
+	})
+}
+
+func Test_updateUserRole(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("FORBIDDEN", func(t *testing.T) {
+		h := New(nil, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/users/2/role", strings.NewReader(`{"role":"owner"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusForbidden, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":false,"error":{"code":"FORBIDDEN"}}`, string(body))
+	})
+
+	t.Run("NOT_FOUND", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("admin")
+
+		mock.ExpectExec("UPDATE users SET role").
+			WithArgs("moderator", "2", m.UserIDValue, m.AppIDValue, false).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/users/2/role", strings.NewReader(`{"role":"moderator"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		h := New(db, nil)
+		m := middleware.New()
+		m.RoleValue = testutil.Ptr("owner")
+
+		mock.ExpectExec("UPDATE users SET role").
+			WithArgs("admin", "2", m.UserIDValue, m.AppIDValue, true).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/users/2/role", strings.NewReader(`{"role":" admin "}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, _ := app.Test(req)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"success":true,"error":null}`, string(body))
+	})
+}
+
+func Test_updateAvatar(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("ASSETS_BASE_URL", "https://assets.aloy.com")
+
+	newRequest := func() *http.Request {
+		buf := &bytes.Buffer{}
+		writer := multipart.NewWriter(buf)
+		avatar := testutil.CreateFormFile(writer, "avatar", "a.png", "image/png")
+		png.Encode(avatar, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+		writer.Close()
+
+		req := httptest.NewRequest(fiber.MethodPut, "/v1/users/me/avatar", buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req
+	}
+
+	t.Run("INTERNAL_SERVER_ERROR", func(t *testing.T) {
+		db, mock := db.New()
+		storage := storage.New()
+		h := New(db, storage)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT avatar_url FROM users").
+			WithArgs(m.UserIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"avatar_url"}).AddRow("https://assets.aloy.com/avatars/1.png"))
+
+		mock.ExpectExec("UPDATE users SET avatar_url").
+			WithArgs(sqlmock.AnyArg(), m.UserIDValue).
+			WillReturnError(errors.New("database is locked"))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		resp, _ := app.Test(newRequest())
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(1, storage.UploadN)
+		// The new avatar is removed, the old one is kept
+		assert.Equal([][]string{{storage.UploadOpts[0].Key}}, storage.DeleteMultipleKeys)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := db.New()
+		storage := storage.New()
+		h := New(db, storage)
+		m := middleware.New()
+
+		mock.ExpectQuery("SELECT avatar_url FROM users").
+			WithArgs(m.UserIDValue).
+			WillReturnRows(sqlmock.NewRows([]string{"avatar_url"}).AddRow("https://assets.aloy.com/avatars/1.png"))
+
+		mock.ExpectExec("UPDATE users SET avatar_url").
+			WithArgs(sqlmock.AnyArg(), m.UserIDValue).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := fiber.New()
+		h.Register(app, m)
+
+		resp, _ := app.Test(newRequest())
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		assert.Equal(1, storage.UploadN)
+		assert.Equal([][]string{{"avatars/1.png"}}, storage.DeleteMultipleKeys)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Regexp(`^{"user":{"avatar_url":"https://assets.aloy.com/avatars/\d+.png"},"error":null}$`, string(body))
+	})
 }
@@ -0,0 +1,182 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/brantem/aloy/db"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrUnavailable = errs.NewCodeError("UNAVAILABLE")
+	ErrReadOnly    = errs.NewCodeError("READ_ONLY")
+	ErrOutdated    = errs.NewCodeError("OUTDATED")
+)
+
+const timeout = 3 * time.Second
+
+// writeCheckInterval is how long the result of the write check is reused, it
+// holds the write lock while it runs
+const writeCheckInterval = 30 * time.Second
+
+type Check struct {
+	Status string `json:"status"`
+	Error  error  `json:"error"`
+}
+
+func newCheck(err error) *Check {
+	if err != nil {
+		return &Check{"error", err}
+	}
+	return &Check{"ok", nil}
+}
+
+type Health struct {
+	db      *sqlx.DB
+	storage storage.StorageInterface
+
+	mu             sync.Mutex
+	writeCheckedAt time.Time
+	writeErr       error
+}
+
+func New(db *sqlx.DB, storage storage.StorageInterface) *Health {
+	return &Health{db: db, storage: storage}
+}
+
+func (h *Health) Register(r fiber.Router) {
+	r.Get("/health", h.health)
+}
+
+// RegisterProbes mounts /livez and /readyz, which are only served next to pprof
+// and metrics since /readyz writes to the database.
+func (h *Health) RegisterProbes(r fiber.Router) {
+	r.Get("/livez", h.livez)
+	r.Get("/readyz", h.readyz)
+}
+
+func (h *Health) health(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).Send([]byte("ok"))
+}
+
+func (h *Health) livez(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ok"})
+}
+
+func (h *Health) readyz(c *fiber.Ctx) error {
+	var result struct {
+		Status string `json:"status"`
+		Checks struct {
+			DB         *Check `json:"db"`
+			Migrations *Check `json:"migrations"`
+			Storage    *Check `json:"storage"`
+		} `json:"checks"`
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result.Checks.DB = newCheck(h.checkDB(ctx))
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result.Checks.Migrations = newCheck(h.checkMigrations(ctx))
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result.Checks.Storage = newCheck(h.checkStorage(ctx))
+	}()
+
+	wg.Wait()
+
+	for _, check := range []*Check{result.Checks.DB, result.Checks.Migrations, result.Checks.Storage} {
+		if check.Error != nil {
+			result.Status = "error"
+			return c.Status(fiber.StatusServiceUnavailable).JSON(result)
+		}
+	}
+
+	result.Status = "ok"
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+func (h *Health) checkDB(ctx context.Context) error {
+	if err := h.db.PingContext(ctx); err != nil {
+		log.Error().Err(err).Msg("health.checkDB")
+		return ErrUnavailable
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.writeCheckedAt) < writeCheckInterval {
+		return h.writeErr
+	}
+
+	err := h.checkWrite(ctx)
+	// Anything else, like SQLITE_BUSY, is usually gone by the next probe
+	if err == nil || err == ErrReadOnly {
+		h.writeCheckedAt, h.writeErr = time.Now(), err
+	}
+	return err
+}
+
+func (h *Health) checkWrite(ctx context.Context) error {
+	// SQLite opens a database it can't write to as read-only, so the only reliable
+	// way to know is to attempt a write
+	tx, err := h.db.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Error().Err(err).Msg("health.checkWrite")
+		return ErrUnavailable
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE readyz (id INTEGER)`); err != nil {
+		log.Error().Err(err).Msg("health.checkWrite")
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrReadonly {
+			return ErrReadOnly
+		}
+		return ErrUnavailable
+	}
+
+	return nil
+}
+
+func (h *Health) checkMigrations(ctx context.Context) error {
+	var name string
+	if err := h.db.QueryRowContext(ctx, `SELECT name FROM migrations ORDER BY id DESC LIMIT 1`).Scan(&name); err != nil {
+		log.Error().Err(err).Msg("health.checkMigrations")
+		return ErrOutdated
+	}
+
+	if name != db.Migration {
+		log.Error().Str("name", name).Str("expected", db.Migration).Msg("health.checkMigrations")
+		return ErrOutdated
+	}
+
+	return nil
+}
+
+func (h *Health) checkStorage(ctx context.Context) error {
+	if err := h.storage.Ping(ctx); err != nil {
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package health
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/db"
+	testdb "github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_livez(t *testing.T) {
+	h := New(nil, nil)
+
+	app := fiber.New()
+	h.RegisterProbes(app)
+
+	resp, _ := app.Test(httptest.NewRequest(fiber.MethodGet, "/livez", nil))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"status":"ok"}`, string(body))
+}
+
+func Test_readyz(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("ok", func(t *testing.T) {
+		sqlDB, mock := testdb.New()
+		h := New(sqlDB, storage.New())
+
+		mock.MatchExpectationsInOrder(false)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE readyz").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		mock.ExpectQuery("SELECT name FROM migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(db.Migration))
+
+		app := fiber.New()
+		h.RegisterProbes(app)
+
+		resp, _ := app.Test(httptest.NewRequest(fiber.MethodGet, "/readyz", nil))
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"status":"ok","checks":{"db":{"status":"ok","error":null},"migrations":{"status":"ok","error":null},"storage":{"status":"ok","error":null}}}`, string(body))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		sqlDB, mock := testdb.New()
+		s := storage.New()
+		s.PingError = errors.New("failed")
+		h := New(sqlDB, s)
+
+		mock.MatchExpectationsInOrder(false)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE readyz").WillReturnError(sqlite3.Error{Code: sqlite3.ErrReadonly})
+		mock.ExpectRollback()
+
+		mock.ExpectQuery("SELECT name FROM migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("0000_init.sql"))
+
+		app := fiber.New()
+		h.RegisterProbes(app)
+
+		resp, _ := app.Test(httptest.NewRequest(fiber.MethodGet, "/readyz", nil))
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusServiceUnavailable, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"status":"error","checks":{"db":{"status":"error","error":{"code":"READ_ONLY"}},"migrations":{"status":"error","error":{"code":"OUTDATED"}},"storage":{"status":"error","error":{"code":"UNAVAILABLE"}}}}`, string(body))
+	})
+
+	t.Run("busy", func(t *testing.T) {
+		sqlDB, mock := testdb.New()
+		h := New(sqlDB, storage.New())
+
+		mock.MatchExpectationsInOrder(false)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE readyz").WillReturnError(sqlite3.Error{Code: sqlite3.ErrBusy})
+		mock.ExpectRollback()
+
+		mock.ExpectQuery("SELECT name FROM migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(db.Migration))
+
+		app := fiber.New()
+		h.RegisterProbes(app)
+
+		resp, _ := app.Test(httptest.NewRequest(fiber.MethodGet, "/readyz", nil))
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusServiceUnavailable, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"status":"error","checks":{"db":{"status":"error","error":{"code":"UNAVAILABLE"}},"migrations":{"status":"ok","error":null},"storage":{"status":"ok","error":null}}}`, string(body))
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		sqlDB, mock := testdb.New()
+		h := New(sqlDB, storage.New())
+
+		mock.MatchExpectationsInOrder(false)
+
+		// The write is only checked by the first probe
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE readyz").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		for range 2 {
+			mock.ExpectQuery("SELECT name FROM migrations").
+				WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(db.Migration))
+		}
+
+		app := fiber.New()
+		h.RegisterProbes(app)
+
+		for range 2 {
+			resp, _ := app.Test(httptest.NewRequest(fiber.MethodGet, "/readyz", nil))
+			assert.Equal(fiber.StatusOK, resp.StatusCode)
+		}
+		assert.Nil(mock.ExpectationsWereMet())
+	})
+}
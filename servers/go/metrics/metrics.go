@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	sqldblogger "github.com/simukti/sqldb-logger"
+)
+
+var (
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: constant.AppID,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: constant.AppID,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: constant.AppID,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database call latency by driver operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"op"})
+
+	DBQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: constant.AppID,
+		Name:      "db_query_errors_total",
+		Help:      "Total number of failed database calls by driver operation.",
+	}, []string{"op"})
+
+	StorageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: constant.AppID,
+		Name:      "storage_duration_seconds",
+		Help:      "Storage call latency by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})
+
+	StorageFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: constant.AppID,
+		Name:      "storage_failures_total",
+		Help:      "Total number of failed storage calls by operation.",
+	}, []string{"op"})
+
+	AttachmentSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: constant.AppID,
+		Name:      "attachment_size_bytes",
+		Help:      "Size of uploaded attachments.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+	})
+
+	PinsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: constant.AppID,
+		Name:      "pins_created_total",
+		Help:      "Total number of pins created by app.",
+	}, []string{"app"})
+
+	CommentsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: constant.AppID,
+		Name:      "comments_created_total",
+		Help:      "Total number of comments created by app, including the first comment of a pin.",
+	}, []string{"app"})
+
+	PinsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: constant.AppID,
+		Name:      "pins_completed_total",
+		Help:      "Total number of pins completed by app.",
+	}, []string{"app"})
+)
+
+// maxApps caps the values of the app label. Aloy-App-ID is picked by the
+// client, so apps seen after the first maxApps are counted as "other".
+const maxApps = 100
+
+var apps = struct {
+	sync.Mutex
+	m map[string]struct{}
+}{m: map[string]struct{}{}}
+
+// App returns the app label for appID
+func App(appID string) string {
+	apps.Lock()
+	defer apps.Unlock()
+
+	if _, ok := apps.m[appID]; ok {
+		return appID
+	}
+	if len(apps.m) >= maxApps {
+		return "other"
+	}
+	apps.m[appID] = struct{}{}
+	return appID
+}
+
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// Middleware labels requests by the registered route instead of the raw path to
+// keep the cardinality bounded.
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else {
+			status = fiber.StatusInternalServerError
+		}
+	}
+
+	method := c.Method()
+	route := c.Route().Path
+	RequestsTotal.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	RequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func Storage(op string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	StorageDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StorageFailures.WithLabelValues(op).Inc()
+	}
+	return err
+}
+
+// DBLogger records the duration of every driver call logged by sqldb-logger
+// before passing it on.
+type DBLogger struct {
+	sqldblogger.Logger
+}
+
+func NewDBLogger(logger sqldblogger.Logger) *DBLogger {
+	return &DBLogger{logger}
+}
+
+func (l *DBLogger) Log(ctx context.Context, level sqldblogger.Level, msg string, data map[string]interface{}) {
+	if v, ok := data["duration"].(float64); ok {
+		DBQueryDuration.WithLabelValues(msg).Observe(v / 1000) // sqldb-logger reports milliseconds
+	}
+	if _, ok := data["error"]; ok {
+		DBQueryErrors.WithLabelValues(msg).Inc()
+	}
+
+	l.Logger.Log(ctx, level, msg, data)
+}
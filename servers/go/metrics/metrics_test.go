@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	sqldblogger "github.com/simukti/sqldb-logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware)
+	app.Get("/pins/:pinId<int>", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	before := testutil.ToFloat64(RequestsTotal.WithLabelValues("GET", "/pins/:pinId<int>", "201"))
+
+	req := httptest.NewRequest(fiber.MethodGet, "/pins/1", nil)
+	app.Test(req)
+
+	assert.Equal(t, before+1, testutil.ToFloat64(RequestsTotal.WithLabelValues("GET", "/pins/:pinId<int>", "201")))
+}
+
+func TestApp(t *testing.T) {
+	assert := assert.New(t)
+
+	apps.m = map[string]struct{}{}
+	for i := range maxApps {
+		assert.Equal(fmt.Sprint(i), App(fmt.Sprint(i)))
+	}
+	assert.Equal("other", App("new"))
+	assert.Equal("0", App("0"))
+}
+
+func TestStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	before := testutil.ToFloat64(StorageFailures.WithLabelValues("test"))
+
+	assert.Nil(Storage("test", func() error { return nil }))
+	assert.Equal(before, testutil.ToFloat64(StorageFailures.WithLabelValues("test")))
+
+	err := errors.New("failed")
+	assert.Equal(err, Storage("test", func() error { return err }))
+	assert.Equal(before+1, testutil.ToFloat64(StorageFailures.WithLabelValues("test")))
+}
+
+type logger struct {
+	n int
+}
+
+func (l *logger) Log(ctx context.Context, level sqldblogger.Level, msg string, data map[string]interface{}) {
+	l.n += 1
+}
+
+func TestDBLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &logger{}
+	dbLogger := NewDBLogger(l)
+
+	before := testutil.ToFloat64(DBQueryErrors.WithLabelValues("ExecContext"))
+
+	dbLogger.Log(context.TODO(), sqldblogger.LevelDebug, "ExecContext", map[string]interface{}{"duration": float64(1)})
+	dbLogger.Log(context.TODO(), sqldblogger.LevelError, "ExecContext", map[string]interface{}{"duration": float64(1), "error": "failed"})
+
+	assert.Equal(2, l.n)
+	assert.Equal(before+1, testutil.ToFloat64(DBQueryErrors.WithLabelValues("ExecContext")))
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Admin guards operational endpoints with a bearer token. An empty token lets
+// every request through, which is only meant for a listener that isn't exposed
+// publicly.
+func Admin(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" {
+			return c.Next()
+		}
+
+		var result struct {
+			Error any `json:"error"`
+		}
+
+		v, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(v), []byte(token)) != 1 {
+			result.Error = fiber.Map{"code": "UNAUTHORIZED"}
+			return c.Status(fiber.StatusUnauthorized).JSON(result)
+		}
+
+		return c.Next()
+	}
+}
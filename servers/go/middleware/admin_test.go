@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmin(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("UNAUTHORIZED", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(Admin("secret"))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		for _, v := range []string{"", "secret", "Bearer wrong"} {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", v)
+
+			resp, _ := app.Test(req, -1)
+			assert.Equal(fiber.StatusUnauthorized, resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(`{"error":{"code":"UNAUTHORIZED"}}`, string(body))
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(Admin("secret"))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+
+		resp, _ := app.Test(req, -1)
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(Admin(""))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		resp, _ := app.Test(httptest.NewRequest("GET", "/", nil), -1)
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+	})
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/util"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/rs/zerolog/log"
+)
+
+type Bucket string
+
+const (
+	// LimitApp is shared by every user of an app and only counts writes
+	LimitApp Bucket = "app"
+	// LimitUsers is keyed by app and IP since there is no user yet
+	LimitUsers Bucket = "users"
+	// LimitWrites is keyed by app and user
+	LimitWrites Bucket = "writes"
+	// LimitUploads is keyed by app and user and only counts requests with files
+	LimitUploads Bucket = "uploads"
+)
+
+var defaultLimits = map[Bucket]string{
+	LimitApp:     "600/1m",
+	LimitUsers:   "30/1m",
+	LimitWrites:  "60/1m",
+	LimitUploads: "20/1m",
+}
+
+// parseLimit parses "<max>/<duration>", e.g. "60/1m". A max of 0 disables the
+// limit, a negative one is rejected so a typo can't do the same.
+func parseLimit(s string) (int, time.Duration, error) {
+	a, b, _ := strings.Cut(s, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < 0 {
+		return 0, 0, fmt.Errorf("negative max: %d", n)
+	}
+	if n == 0 {
+		return 0, 0, nil
+	}
+
+	expiration, err := time.ParseDuration(strings.TrimSpace(b))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return n, expiration, nil
+}
+
+func newLimiters() map[Bucket]fiber.Handler {
+	m := make(map[Bucket]fiber.Handler, len(defaultLimits))
+	for bucket, fallback := range defaultLimits {
+		key := "RATE_LIMIT_" + strings.ToUpper(string(bucket))
+		n, expiration, err := parseLimit(util.Getenv(key, fallback))
+		if err != nil {
+			log.Fatal().Err(err).Str("key", key).Msg("middleware.newLimiters")
+		}
+		if n == 0 {
+			continue
+		}
+
+		m[bucket] = limiter.New(limiter.Config{
+			Next:         skipLimit(bucket),
+			Max:          n,
+			Expiration:   expiration,
+			KeyGenerator: limitKey(bucket),
+			LimitReached: func(c *fiber.Ctx) error {
+				var result struct {
+					Error any `json:"error"`
+				}
+				result.Error = errs.ErrRateLimited
+				return c.Status(fiber.StatusTooManyRequests).JSON(result)
+			},
+		})
+	}
+	return m
+}
+
+func skipLimit(bucket Bucket) func(c *fiber.Ctx) bool {
+	switch bucket {
+	case LimitApp:
+		return func(c *fiber.Ctx) bool {
+			return c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead || c.Method() == fiber.MethodOptions
+		}
+	case LimitUploads:
+		return func(c *fiber.Ctx) bool {
+			form, err := c.MultipartForm()
+			return err != nil || len(form.File) == 0
+		}
+	default:
+		return nil
+	}
+}
+
+func limitKey(bucket Bucket) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		appID, _ := c.Locals(constant.AppIDKey).(string)
+		switch bucket {
+		case LimitApp:
+			return string(bucket) + ":" + appID
+		case LimitUsers:
+			return string(bucket) + ":" + appID + ":" + c.IP()
+		default:
+			userID, _ := c.Locals(constant.UserIDKey).(string)
+			return string(bucket) + ":" + appID + ":" + userID
+		}
+	}
+}
+
+func (m *Middleware) Limit(bucket Bucket) fiber.Handler {
+	if h, ok := m.limiters[bucket]; ok {
+		return h
+	}
+	return func(c *fiber.Ctx) error {
+		return c.Next()
+	}
+}
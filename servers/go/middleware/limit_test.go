@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	n, expiration, err := parseLimit("60/1m")
+	assert.Equal(60, n)
+	assert.Equal(time.Minute, expiration)
+	assert.Nil(err)
+
+	n, _, err = parseLimit("0")
+	assert.Equal(0, n)
+	assert.Nil(err)
+
+	_, _, err = parseLimit("a/1m")
+	assert.NotNil(err)
+
+	_, _, err = parseLimit("1/a")
+	assert.NotNil(err)
+
+	_, _, err = parseLimit("-1/1m")
+	assert.NotNil(err)
+}
+
+func TestLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("RATE_LIMITED", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_WRITES", "1/1m")
+		m := New(nil)
+
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals(constant.AppIDKey, "test")
+			c.Locals(constant.UserIDKey, c.Get("Aloy-User-ID"))
+			return c.Next()
+		})
+		app.Use(m.Limit(LimitWrites))
+		app.Post("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Aloy-User-ID", "1")
+		resp, _ := app.Test(req, -1)
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+
+		req = httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Aloy-User-ID", "1")
+		resp, _ = app.Test(req, -1)
+		assert.Equal(fiber.StatusTooManyRequests, resp.StatusCode)
+		assert.NotEmpty(resp.Header.Get("Retry-After"))
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"error":{"code":"RATE_LIMITED"}}`, string(body))
+
+		req = httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Aloy-User-ID", "2")
+		resp, _ = app.Test(req, -1)
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("uploads", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_UPLOADS", "1/1m")
+		m := New(nil)
+
+		app := fiber.New()
+		app.Use(m.Limit(LimitUploads))
+		app.Post("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		for i, withFile := range []bool{false, false, true, true} {
+			buf := &bytes.Buffer{}
+			writer := multipart.NewWriter(buf)
+			field, _ := writer.CreateFormField("text")
+			field.Write([]byte("Test"))
+			if withFile {
+				file, _ := writer.CreateFormFile("attachments", "a.png")
+				file.Write([]byte("a"))
+			}
+			writer.Close()
+
+			req := httptest.NewRequest("POST", "/", buf)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			resp, _ := app.Test(req, -1)
+			if i == 3 {
+				assert.Equal(fiber.StatusTooManyRequests, resp.StatusCode)
+			} else {
+				assert.Equal(fiber.StatusOK, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_WRITES", "0")
+		m := New(nil)
+
+		app := fiber.New()
+		app.Use(m.Limit(LimitWrites))
+		app.Post("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		for range 3 {
+			resp, _ := app.Test(httptest.NewRequest("POST", "/", nil), -1)
+			assert.Equal(fiber.StatusOK, resp.StatusCode)
+		}
+	})
+}
@@ -1,15 +1,24 @@
 package middleware
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
 
 type MiddlewareInterface interface {
 	App(c *fiber.Ctx) error
 	User(c *fiber.Ctx) error
+	Limit(bucket Bucket) fiber.Handler
 }
 
 type Middleware struct {
+	db       *sqlx.DB
+	limiters map[Bucket]fiber.Handler
 }
 
-func New() MiddlewareInterface {
-	return &Middleware{}
+func New(db *sqlx.DB) MiddlewareInterface {
+	return &Middleware{
+		db:       db,
+		limiters: newLimiters(),
+	}
 }
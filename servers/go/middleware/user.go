@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"database/sql"
+
 	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/errs"
 	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
 )
 
 func (m *Middleware) User(c *fiber.Ctx) error {
@@ -15,7 +19,26 @@ func (m *Middleware) User(c *fiber.Ctx) error {
 		result.Error = fiber.Map{"code": "MISSING_USER_ID"}
 		return c.Status(fiber.StatusBadRequest).JSON(result)
 	}
+
+	var role string
+	err := m.db.QueryRowContext(c.UserContext(), `
+		SELECT role
+		FROM users
+		WHERE id = ?
+		  AND app_id = ?
+	`, userID, c.Locals(constant.AppIDKey)).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			result.Error = fiber.Map{"code": "INVALID_USER_ID"}
+			return c.Status(fiber.StatusBadRequest).JSON(result)
+		}
+		log.Error().Err(err).Msg("middleware.User")
+		result.Error = errs.ErrInternalServerError
+		return c.Status(fiber.StatusInternalServerError).JSON(result)
+	}
+
 	c.Locals(constant.UserIDKey, userID)
+	c.Locals(constant.RoleKey, role)
 
 	return c.Next()
 }
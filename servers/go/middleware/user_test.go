@@ -5,6 +5,9 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/testutil/db"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 )
@@ -29,12 +32,51 @@ func TestUser(t *testing.T) {
 		assert.Equal(`{"error":{"code":"MISSING_USER_ID"}}`, string(body))
 	})
 
+	t.Run("INVALID_USER_ID", func(t *testing.T) {
+		db, mock := db.New()
+		m := Middleware{db: db}
+
+		mock.ExpectQuery("SELECT role FROM users").
+			WithArgs("1", "test").
+			WillReturnRows(sqlmock.NewRows([]string{"role"}))
+
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals(constant.AppIDKey, "test")
+			return c.Next()
+		})
+		app.Use(m.User)
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Aloy-User-ID", "1")
+
+		resp, _ := app.Test(req, -1)
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Equal(fiber.StatusBadRequest, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(`{"error":{"code":"INVALID_USER_ID"}}`, string(body))
+	})
+
 	t.Run("success", func(t *testing.T) {
-		m := Middleware{}
+		db, mock := db.New()
+		m := Middleware{db: db}
+
+		mock.ExpectQuery("SELECT role FROM users").
+			WithArgs("1", "test").
+			WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("moderator"))
 
 		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals(constant.AppIDKey, "test")
+			return c.Next()
+		})
 		app.Use(m.User)
 		app.Get("/", func(c *fiber.Ctx) error {
+			assert.Equal("1", c.Locals(constant.UserIDKey))
+			assert.Equal("moderator", c.Locals(constant.RoleKey))
 			return c.SendStatus(fiber.StatusOK)
 		})
 
@@ -42,6 +84,7 @@ func TestUser(t *testing.T) {
 		req.Header.Set("Aloy-User-ID", "1")
 
 		resp, _ := app.Test(req, -1)
+		assert.Nil(mock.ExpectationsWereMet())
 		assert.Equal(fiber.StatusOK, resp.StatusCode)
 	})
 }
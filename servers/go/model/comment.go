@@ -6,6 +6,7 @@ type Comment struct {
 	User        *User         `json:"user,omitempty"`
 	Text        string        `json:"text"`
 	Attachments []*Attachment `json:"attachments"`
+	Reactions   []*Reaction   `json:"reactions"`
 	CreatedAt   Time          `json:"created_at" db:"created_at"`
 	UpdatedAt   Time          `json:"updated_at" db:"updated_at"`
 }
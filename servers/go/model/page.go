@@ -0,0 +1,10 @@
+package model
+
+// Page is a path of an app that has pins
+type Page struct {
+	Path           string  `json:"path"`
+	Open           int     `json:"open"`
+	Completed      int     `json:"completed"`
+	LastActivityAt *Time   `json:"last_activity_at" db:"last_activity_at"`
+	Participants   []*User `json:"participants" db:"-"`
+}
@@ -1,17 +1,54 @@
 package model
 
+import "github.com/jmoiron/sqlx/types"
+
+// PinContext is what the browser looked like when the pin was created
+type PinContext struct {
+	// H is the height of the viewport, W on Pin is its width
+	H           int     `json:"h,omitempty" validate:"omitempty,min=1"`
+	DPR         float64 `json:"dpr,omitempty" validate:"omitempty,gt=0,max=16"`
+	UserAgent   string  `json:"user_agent,omitempty" validate:"trim,max=512"`
+	Breakpoint  string  `json:"breakpoint,omitempty" validate:"trim,max=32"`
+	URL         string  `json:"url,omitempty" validate:"trim,omitempty,http_url,max=2048"`
+	ColorScheme string  `json:"color_scheme,omitempty" validate:"omitempty,oneof=light dark"`
+	Locale      string  `json:"locale,omitempty" validate:"trim,omitempty,bcp47_language_tag"`
+}
+
+// Screenshot is the viewport when the pin was created, Data has the same keys
+// as the one of Attachment
+type Screenshot struct {
+	URL  string         `json:"url"`
+	Data map[string]any `json:"data"`
+}
+
 type Pin struct {
-	ID           int      `json:"id"`
-	UserID       int      `json:"-" db:"user_id"`
-	User         *User    `json:"user"`
-	CommentID    int      `json:"-" db:"comment_id"`
-	Comment      *Comment `json:"comment" `
-	Path         string   `json:"path"`
-	W            float64  `json:"w"`
-	X            float64  `json:"_x" db:"_x"`
-	X2           float64  `json:"x" db:"x"`
-	Y            float64  `json:"_y" db:"_y"`
-	Y2           float64  `json:"y" db:"y"`
-	CompletedAt  *Time    `json:"completed_at" db:"completed_at"`
-	TotalReplies int      `json:"total_replies" db:"total_replies"`
+	ID            int                `json:"id"`
+	UserID        int                `json:"-" db:"user_id"`
+	User          *User              `json:"user"`
+	Assignees     []*User            `json:"assignees" db:"-"`
+	Labels        []*Label           `json:"labels" db:"-"`
+	CommentID     int                `json:"-" db:"comment_id"`
+	Comment       *Comment           `json:"comment" `
+	Path          string             `json:"path"`
+	W             float64            `json:"w"`
+	X             float64            `json:"_x" db:"_x"`
+	X2            float64            `json:"x" db:"x"`
+	Y             float64            `json:"_y" db:"_y"`
+	Y2            float64            `json:"y" db:"y"`
+	Environment   *string            `json:"environment"`
+	Version       *string            `json:"version"`
+	RawContext    types.NullJSONText `json:"-" db:"context"`
+	Context       *PinContext        `json:"context" db:"-"`
+	RawScreenshot types.NullJSONText `json:"-" db:"screenshot"`
+	Screenshot    *Screenshot        `json:"screenshot" db:"-"`
+	Status        string             `json:"status"`
+	CompletedAt   *Time              `json:"completed_at" db:"completed_at"`
+	DetachedAt    *Time              `json:"detached_at" db:"detached_at"`
+	TotalReplies  int                `json:"total_replies" db:"total_replies"`
+	UnreadCount   int                `json:"unread_count" db:"unread_count"`
+	HasUnread     bool               `json:"has_unread" db:"-"`
+	Watching      bool               `json:"watching"`
+	// InBreakpoint is only set when pins are flagged instead of filtered by
+	// breakpoint
+	InBreakpoint *bool `json:"in_breakpoint,omitempty" db:"-"`
 }
@@ -0,0 +1,15 @@
+package model
+
+// PinPosition is where a pin was before it was moved
+type PinPosition struct {
+	ID        int     `json:"id"`
+	UserID    int     `json:"-" db:"user_id"`
+	User      *User   `json:"user"`
+	Path      string  `json:"path"`
+	W         float64 `json:"w"`
+	X         float64 `json:"_x" db:"_x"`
+	X2        float64 `json:"x" db:"x"`
+	Y         float64 `json:"_y" db:"_y"`
+	Y2        float64 `json:"y" db:"y"`
+	CreatedAt Time    `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,10 @@
+package model
+
+type PinStatus struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"-" db:"user_id"`
+	User      *User  `json:"user"`
+	From      string `json:"from" db:"from_status"`
+	To        string `json:"to" db:"to_status"`
+	CreatedAt Time   `json:"created_at" db:"created_at"`
+}
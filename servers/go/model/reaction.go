@@ -0,0 +1,9 @@
+package model
+
+type Reaction struct {
+	CommentID int    `json:"-" db:"comment_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"`
+	// Reacted is true when the current user is one of the reactors
+	Reacted bool `json:"reacted"`
+}
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type Status struct {
+	Key    string `json:"key" validate:"trim,required,max=32"`
+	Name   string `json:"name" validate:"trim,required,max=64"`
+	Closed bool   `json:"closed"`
+}
+
+// PathRewrite replaces the parts of a path matched by Pattern, a regexp, with
+// Replacement, which can refer to its groups like "$1"
+type PathRewrite struct {
+	Pattern     string `json:"pattern" validate:"required,max=256"`
+	Replacement string `json:"replacement" validate:"max=256"`
+
+	re *regexp.Regexp
+}
+
+// PathRules normalize the _path of pins, so that variants of the same page
+// share their pins
+type PathRules struct {
+	Lowercase         bool `json:"lowercase"`
+	TrimTrailingSlash bool `json:"trim_trailing_slash"`
+	// Rewrites are applied in order, after Lowercase
+	Rewrites []*PathRewrite `json:"rewrites" validate:"omitempty,max=50,dive"`
+}
+
+// Compile compiles the patterns of the rewrites once, so Normalize doesn't have
+// to for every path
+func (r *PathRules) Compile() error {
+	if r == nil {
+		return nil
+	}
+	for _, rewrite := range r.Rewrites {
+		re, err := regexp.Compile(rewrite.Pattern)
+		if err != nil {
+			return err
+		}
+		rewrite.re = re
+	}
+	return nil
+}
+
+// Normalize returns path with the rules applied
+func (r *PathRules) Normalize(path string) string {
+	if r == nil {
+		return path
+	}
+
+	if r.Lowercase {
+		path = strings.ToLower(path)
+	}
+
+	for _, rewrite := range r.Rewrites {
+		re := rewrite.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(rewrite.Pattern); err != nil {
+				continue // the patterns are validated before they're saved
+			}
+		}
+		path = re.ReplaceAllString(path, rewrite.Replacement)
+	}
+
+	if r.TrimTrailingSlash {
+		path = strings.TrimRight(path, "/")
+	}
+
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// VersionRules decide which pins show up when pins are filtered by version
+type VersionRules struct {
+	// CarryOpen also shows the open pins left on other versions, so they follow
+	// the app to its next deploy
+	CarryOpen bool `json:"carry_open"`
+}
+
+type Settings struct {
+	Statuses []*Status `json:"statuses" validate:"omitempty,min=1,dive"`
+	// Transitions maps a status to the statuses it can move to
+	Transitions map[string][]string `json:"transitions"`
+	Paths       *PathRules          `json:"paths"`
+	Versions    *VersionRules       `json:"versions"`
+	// Breakpoints are window widths in ascending order, pins are only shown on
+	// the layout they were created on
+	Breakpoints []int `json:"breakpoints"`
+}
+
+func (s *Settings) Status(key string) *Status {
+	for _, status := range s.Statuses {
+		if status.Key == key {
+			return status
+		}
+	}
+	return nil
+}
+
+// DefaultStatus returns the first open status, which new and reopened pins get
+func (s *Settings) DefaultStatus() *Status {
+	for _, status := range s.Statuses {
+		if !status.Closed {
+			return status
+		}
+	}
+	return nil
+}
+
+// ClosedStatus returns the first closed status, which completed pins get
+func (s *Settings) ClosedStatus() *Status {
+	for _, status := range s.Statuses {
+		if status.Closed {
+			return status
+		}
+	}
+	return nil
+}
+
+func (s *Settings) CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	v, ok := s.Transitions[from]
+	if !ok {
+		return s.Status(from) == nil // pins left with a removed status can move anywhere
+	}
+	return slices.Contains(v, to)
+}
+
+// Breakpoint returns the range of window widths w falls in, start is exclusive
+// and end is inclusive. An end of 0 has no upper bound. ok is false when there
+// are no breakpoints.
+func (s *Settings) Breakpoint(w float64) (start, end float64, ok bool) {
+	if len(s.Breakpoints) == 0 {
+		return 0, 0, false
+	}
+	for i := len(s.Breakpoints) - 1; i >= 0; i-- {
+		if w > float64(s.Breakpoints[i]) {
+			start = float64(s.Breakpoints[i])
+			if i+1 < len(s.Breakpoints) {
+				end = float64(s.Breakpoints[i+1])
+			}
+			return start, end, true
+		}
+	}
+	return 0, float64(s.Breakpoints[0]), true
+}
@@ -1,6 +1,11 @@
 package model
 
+import "github.com/jmoiron/sqlx/types"
+
 type User struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Email     *string         `json:"email,omitempty"`
+	AvatarURL *string         `json:"avatar_url,omitempty" db:"avatar_url"`
+	Metadata  *types.JSONText `json:"metadata,omitempty"`
 }
@@ -0,0 +1,328 @@
+// Package notifier emails users about the notifications queued by the handlers,
+// either as soon as possible or as a daily digest.
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brantem/aloy/text"
+	"github.com/brantem/aloy/tracing"
+	"github.com/brantem/aloy/util"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+type Notification struct {
+	ID          int     `db:"id"`
+	Type        string  `db:"type"`
+	Data        *string `db:"data"`
+	Email       string  `db:"email"`
+	Path        string  `db:"_path"`
+	ActorName   string  `db:"actor_name"`
+	CommentText *string `db:"comment_text"`
+}
+
+func (n *Notification) Subject() string {
+	switch n.Type {
+	case "mention":
+		return fmt.Sprintf("%s mentioned you on %s", n.ActorName, n.Path)
+	case "status":
+		return fmt.Sprintf("%s changed the status of a pin on %s to %s", n.ActorName, n.Path, *n.Data)
+	default:
+		return fmt.Sprintf("%s replied on %s", n.ActorName, n.Path)
+	}
+}
+
+const (
+	// batchSize is how many notifications are claimed at a time
+	batchSize = 100
+	// maxAttempts is how many times a notification is sent before it's given up,
+	// like when the address is rejected
+	maxAttempts = 5
+	// claimTimeout is how long a claimed notification waits before it's sent
+	// again, either because sending failed or the server stopped halfway
+	claimTimeout = 10 * time.Minute
+)
+
+type Notifier struct {
+	db     *sqlx.DB
+	mailer MailerInterface
+
+	interval time.Duration
+	digestAt time.Duration // since midnight UTC
+
+	lastDigest time.Time
+}
+
+// New returns nil when SMTP_ADDR isn't set
+func New(db *sqlx.DB) *Notifier {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	interval, err := time.ParseDuration(util.Getenv("NOTIFICATIONS_INTERVAL", "1m"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("notifier.New")
+	}
+
+	t, err := time.Parse("15:04", util.Getenv("NOTIFICATIONS_DIGEST_AT", "09:00"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("notifier.New")
+	}
+
+	return &Notifier{
+		db:     db,
+		mailer: NewMailer(addr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), util.Getenv("SMTP_FROM", "aloy@localhost")),
+
+		interval: interval,
+		digestAt: time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute,
+	}
+}
+
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n.SendInstant(ctx)
+
+			now = now.UTC()
+			if due := now.Truncate(24 * time.Hour).Add(n.digestAt); !now.Before(due) && n.lastDigest.Before(due) {
+				if n.claimDigest(ctx, due) {
+					n.SendDigests(ctx)
+				}
+				n.lastDigest = due
+			}
+		}
+	}
+}
+
+// claimDigest reports whether the digest due at due is still to be sent by
+// this server. It's recorded in the database, so the digest goes out once even
+// with several servers, and still goes out when the server starts after it was
+// due.
+func (n *Notifier) claimDigest(ctx context.Context, due time.Time) bool {
+	res, err := n.db.ExecContext(ctx, `
+		INSERT INTO notification_digests (due_at)
+		VALUES (?)
+		ON CONFLICT (due_at) DO NOTHING
+	`, due.Format(time.DateTime))
+	if err != nil {
+		log.Error().Err(err).Msg("notifier.claimDigest")
+		return false
+	}
+
+	v, _ := res.RowsAffected()
+	return v == 1
+}
+
+// SendInstant sends one email per notification to the users who want them
+// right away.
+func (n *Notifier) SendInstant(ctx context.Context) {
+	ctx, span := tracing.Start(ctx, "notifier.SendInstant")
+	defer span.End()
+
+	for {
+		nodes, err := n.claim(ctx, "instant")
+		if err != nil {
+			return
+		}
+
+		for _, node := range nodes {
+			body := node.Subject()
+			if node.CommentText != nil {
+				body += "\n\n" + *node.CommentText
+			}
+
+			if err := n.mailer.Send(node.Email, node.Subject(), body); err != nil {
+				log.Error().Err(err).Msg("notifier.SendInstant")
+				continue
+			}
+			n.markSent(ctx, []int{node.ID})
+		}
+
+		if len(nodes) < batchSize {
+			return
+		}
+	}
+}
+
+// SendDigests sends every user who wants a daily digest one email with all of
+// their notifications.
+func (n *Notifier) SendDigests(ctx context.Context) {
+	ctx, span := tracing.Start(ctx, "notifier.SendDigests")
+	defer span.End()
+
+	for {
+		nodes, err := n.claim(ctx, "daily")
+		if err != nil {
+			return
+		}
+
+		n.sendDigests(ctx, nodes)
+
+		if len(nodes) < batchSize {
+			return
+		}
+	}
+}
+
+// sendDigests groups nodes by email. Batches are ordered by user, so only the
+// user at the end of a full batch can get their digest in two emails.
+func (n *Notifier) sendDigests(ctx context.Context, nodes []*Notification) {
+	var emails []string
+	m := make(map[string][]*Notification)
+	for _, node := range nodes {
+		if _, ok := m[node.Email]; !ok {
+			emails = append(emails, node.Email)
+		}
+		m[node.Email] = append(m[node.Email], node)
+	}
+
+	for _, email := range emails {
+		var b strings.Builder
+		ids := make([]int, len(m[email]))
+		for i, node := range m[email] {
+			ids[i] = node.ID
+
+			b.WriteString("- " + node.Subject() + "\n")
+			if node.CommentText != nil {
+				b.WriteString("  " + strings.ReplaceAll(*node.CommentText, "\n", "\n  ") + "\n")
+			}
+		}
+
+		subject := fmt.Sprintf("%d new notifications", len(ids))
+		if len(ids) == 1 {
+			subject = "1 new notification"
+		}
+
+		if err := n.mailer.Send(email, subject, b.String()); err != nil {
+			log.Error().Err(err).Msg("notifier.sendDigests")
+			continue
+		}
+		n.markSent(ctx, ids)
+	}
+}
+
+// claim takes the next batch of unsent notifications of the users with the
+// preference, so no other server sends them too. Notifications that aren't
+// marked as sent are claimed again after claimTimeout, up to maxAttempts times.
+func (n *Notifier) claim(ctx context.Context, preference string) ([]*Notification, error) {
+	var ids []int
+	err := n.db.SelectContext(ctx, &ids, `
+		UPDATE notifications
+		SET claimed_at = CURRENT_TIMESTAMP,
+		    attempts = attempts + 1
+		WHERE id IN (
+		  SELECT n.id
+		  FROM notifications n
+		  JOIN users u ON u.id = n.user_id
+		  WHERE n.sent_at IS NULL
+		    AND (n.claimed_at IS NULL OR n.claimed_at < datetime('now', ?))
+		    AND n.attempts < ?
+		    AND u.notifications = ?
+		    AND u.email IS NOT NULL
+		  ORDER BY n.user_id ASC, n.id ASC
+		  LIMIT ?
+		)
+		RETURNING id
+	`, fmt.Sprintf("-%d seconds", int(claimTimeout.Seconds())), maxAttempts, preference, batchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("notifier.claim")
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT n.id, n.type, n.data, u.email, p._path, a.name AS actor_name, c.text AS comment_text
+		FROM notifications n
+		JOIN users u ON u.id = n.user_id
+		JOIN users a ON a.id = n.actor_id
+		JOIN pins p ON p.id = n.pin_id
+		LEFT JOIN comments c ON c.id = n.comment_id
+		WHERE n.id IN (?)
+		ORDER BY n.user_id ASC, n.id ASC
+	`, ids)
+	if err != nil {
+		log.Error().Err(err).Msg("notifier.claim")
+		return nil, err
+	}
+
+	var nodes []*Notification
+	if err := n.db.SelectContext(ctx, &nodes, query, args...); err != nil {
+		log.Error().Err(err).Msg("notifier.claim")
+		return nil, err
+	}
+
+	var userIds []int
+	for _, node := range nodes {
+		if node.CommentText != nil {
+			userIds = append(userIds, text.Mentions(*node.CommentText)...)
+		}
+	}
+
+	names, err := n.names(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		if node.CommentText != nil {
+			v := text.Plain(*node.CommentText, names)
+			node.CommentText = &v
+		}
+	}
+
+	return nodes, nil
+}
+
+func (n *Notifier) names(ctx context.Context, userIds []int) (map[int]string, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT id, name FROM users WHERE id IN (?)`, userIds)
+	if err != nil {
+		log.Error().Err(err).Msg("notifier.names")
+		return nil, err
+	}
+
+	rows, err := n.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("notifier.names")
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[int]string, len(userIds))
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			log.Error().Err(err).Msg("notifier.names")
+			return nil, err
+		}
+		m[id] = name
+	}
+
+	return m, nil
+}
+
+func (n *Notifier) markSent(ctx context.Context, ids []int) {
+	query, args, _ := sqlx.In(`UPDATE notifications SET sent_at = CURRENT_TIMESTAMP WHERE id IN (?)`, ids)
+	if _, err := n.db.ExecContext(ctx, query, args...); err != nil {
+		log.Error().Err(err).Msg("notifier.markSent")
+	}
+}
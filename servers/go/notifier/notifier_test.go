@@ -0,0 +1,151 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brantem/aloy/testutil"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/brantem/aloy/testutil/smtp"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotification_Subject(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("User 1 replied on /", (&Notification{Type: "reply", ActorName: "User 1", Path: "/"}).Subject())
+	assert.Equal("User 1 mentioned you on /", (&Notification{Type: "mention", ActorName: "User 1", Path: "/"}).Subject())
+	assert.Equal("User 1 changed the status of a pin on / to Resolved", (&Notification{Type: "status", ActorName: "User 1", Path: "/", Data: testutil.Ptr("Resolved")}).Subject())
+}
+
+// mailer fails for the addresses in fail
+type mailer struct {
+	fail string
+	sent []string
+}
+
+func (m *mailer) Send(to, subject, body string) error {
+	if to == m.fail {
+		return errors.New("rejected")
+	}
+	m.sent = append(m.sent, to)
+	return nil
+}
+
+func newDB(t *testing.T) *sqlx.DB {
+	db := db.NewSQLite(t, "../../migrations")
+	db.MustExec(`
+		INSERT INTO users (id, _id, app_id, name, email, notifications)
+		VALUES
+		  (1, 'a', 'test', 'User 1', NULL, 'instant'),
+		  (2, 'b', 'test', 'User 2', 'user2@example.com', 'instant'),
+		  (3, 'c', 'test', 'User 3', 'user3@example.com', 'daily')
+	`)
+	db.MustExec(`INSERT INTO pins (id, app_id, user_id, _path, path, w, _x, x, _y, y) VALUES (1, 'test', 1, '/', 'body', 1, 1, 1, 1, 1)`)
+	db.MustExec(`INSERT INTO comments (id, pin_id, user_id, text) VALUES (1, 1, 1, 'Test')`)
+	return db
+}
+
+func TestNotifier_SendInstant(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := smtp.New()
+	defer srv.Close()
+
+	db := newDB(t)
+	db.MustExec(`UPDATE comments SET text = '[{"type":"paragraph","children":[{"text":"Hi "},{"type":"mention","user_id":2,"children":[{"text":""}]}]}]'`)
+	db.MustExec(`INSERT INTO notifications (user_id, pin_id, actor_id, comment_id, type) VALUES (2, 1, 1, 1, 'mention'), (3, 1, 1, 1, 'reply')`)
+
+	n := &Notifier{db: db, mailer: NewMailer(srv.Addr(), "", "", "aloy@localhost")}
+	n.SendInstant(context.TODO())
+
+	messages := srv.Messages()
+	if assert.Len(messages, 1) {
+		assert.Equal([]string{"user2@example.com"}, messages[0].To)
+		assert.Contains(messages[0].Data, "Subject: User 1 mentioned you on /\r\n")
+		assert.Contains(messages[0].Data, "\r\n\r\nUser 1 mentioned you on /\r\n\r\nHi @User 2")
+	}
+
+	// Sent notifications aren't sent again
+	n.SendInstant(context.TODO())
+	assert.Len(srv.Messages(), 1)
+}
+
+func TestNotifier_claim(t *testing.T) {
+	assert := assert.New(t)
+
+	db := newDB(t)
+	for range batchSize + 1 {
+		db.MustExec(`INSERT INTO notifications (user_id, pin_id, actor_id, type) VALUES (2, 1, 1, 'reply')`)
+	}
+
+	a := &Notifier{db: db}
+	b := &Notifier{db: db}
+
+	// Batches don't overlap, so two servers never send the same notification
+	nodes, _ := a.claim(context.TODO(), "instant")
+	assert.Len(nodes, batchSize)
+	nodes, _ = b.claim(context.TODO(), "instant")
+	if assert.Len(nodes, 1) {
+		assert.Equal(batchSize+1, nodes[0].ID)
+	}
+	nodes, _ = a.claim(context.TODO(), "instant")
+	assert.Empty(nodes)
+}
+
+func TestNotifier_attempts(t *testing.T) {
+	assert := assert.New(t)
+
+	db := newDB(t)
+	db.MustExec(`INSERT INTO notifications (user_id, pin_id, actor_id, type) VALUES (2, 1, 1, 'reply')`)
+
+	m := &mailer{fail: "user2@example.com"}
+	n := &Notifier{db: db, mailer: m}
+
+	for range maxAttempts + 1 {
+		n.SendInstant(context.TODO())
+		// Claims of failed notifications only run out after claimTimeout
+		n.SendInstant(context.TODO())
+		db.MustExec(`UPDATE notifications SET claimed_at = datetime(claimed_at, '-1 day')`)
+	}
+
+	var attempts int
+	db.Get(&attempts, `SELECT attempts FROM notifications`)
+	assert.Equal(maxAttempts, attempts)
+	assert.Empty(m.sent)
+}
+
+func TestNotifier_SendDigests(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := smtp.New()
+	defer srv.Close()
+
+	db := newDB(t)
+	db.MustExec(`INSERT INTO notifications (user_id, pin_id, actor_id, comment_id, type, data) VALUES (3, 1, 1, 1, 'reply', NULL), (3, 1, 1, NULL, 'status', 'Resolved'), (2, 1, 1, 1, 'reply', NULL)`)
+
+	n := &Notifier{db: db, mailer: NewMailer(srv.Addr(), "", "", "aloy@localhost")}
+	n.SendDigests(context.TODO())
+
+	messages := srv.Messages()
+	if assert.Len(messages, 1) {
+		assert.Equal([]string{"user3@example.com"}, messages[0].To)
+		assert.Contains(messages[0].Data, "Subject: 2 new notifications\r\n")
+		assert.Contains(messages[0].Data, "- User 1 replied on /\r\n  Test\r\n- User 1 changed the status of a pin on / to Resolved\r\n")
+	}
+}
+
+func TestNotifier_claimDigest(t *testing.T) {
+	assert := assert.New(t)
+
+	db := newDB(t)
+	due := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	// Only one server sends a digest, and a restart doesn't send it again
+	assert.True((&Notifier{db: db}).claimDigest(context.TODO(), due))
+	assert.False((&Notifier{db: db}).claimDigest(context.TODO(), due))
+	assert.True((&Notifier{db: db}).claimDigest(context.TODO(), due.Add(24*time.Hour)))
+}
@@ -0,0 +1,80 @@
+package policy
+
+import "slices"
+
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+	RoleMember    Role = "member"
+	RoleViewer    Role = "viewer"
+)
+
+var Roles = []Role{RoleOwner, RoleAdmin, RoleModerator, RoleMember, RoleViewer}
+
+type Action string
+
+// Actions without an "Any" variant only apply to what the user created
+const (
+	ReadPins Action = "pins:read"
+
+	CreatePin      Action = "pins:create"
+	DeletePin      Action = "pins:delete"
+	DeleteAnyPin   Action = "pins:delete:any"
+	CompletePin    Action = "pins:complete"
+	CompleteAnyPin Action = "pins:complete:any"
+	ReopenPin      Action = "pins:reopen"
+	ReopenAnyPin   Action = "pins:reopen:any"
+	// UpdatePinStatus covers moving between open statuses, closing and reopening
+	// use the actions above
+	UpdatePinStatus    Action = "pins:status"
+	UpdateAnyPinStatus Action = "pins:status:any"
+	AssignPin          Action = "pins:assign"
+	AssignAnyPin       Action = "pins:assign:any"
+	LabelPin           Action = "pins:label"
+	LabelAnyPin        Action = "pins:label:any"
+	MovePin            Action = "pins:move"
+	MoveAnyPin         Action = "pins:move:any"
+	FlagPin            Action = "pins:flag"
+
+	CreateComment    Action = "comments:create"
+	UpdateComment    Action = "comments:update"
+	DeleteComment    Action = "comments:delete"
+	DeleteAnyComment Action = "comments:delete:any"
+	ReactToComment   Action = "comments:react"
+
+	ManageLabels Action = "labels:manage"
+
+	UpdateRole      Action = "roles:update"
+	UpdateOwnerRole Action = "roles:update:owner"
+
+	UpdateSettings Action = "settings:update"
+
+	ReadEmails Action = "users:emails"
+
+	ExportPins Action = "pins:export"
+)
+
+var member = []Action{
+	ReadPins,
+	CreatePin, DeletePin, CompletePin, ReopenPin, UpdatePinStatus, AssignPin, LabelPin, MovePin, FlagPin,
+	CreateComment, UpdateComment, DeleteComment, ReactToComment,
+}
+
+var moderator = slices.Concat(member, []Action{DeleteAnyPin, CompleteAnyPin, ReopenAnyPin, UpdateAnyPinStatus, AssignAnyPin, LabelAnyPin, MoveAnyPin, DeleteAnyComment, ManageLabels})
+
+var admin = slices.Concat(moderator, []Action{UpdateRole, UpdateSettings, ReadEmails, ExportPins})
+
+var permissions = map[Role][]Action{
+	RoleOwner:     slices.Concat(admin, []Action{UpdateOwnerRole}),
+	RoleAdmin:     admin,
+	RoleModerator: moderator,
+	RoleMember:    member,
+	RoleViewer:    {ReadPins},
+}
+
+func Can(role Role, action Action) bool {
+	return slices.Contains(permissions[role], action)
+}
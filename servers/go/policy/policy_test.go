@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Can(RoleViewer, ReadPins))
+	assert.False(Can(RoleViewer, CreateComment))
+	assert.False(Can(RoleViewer, ReactToComment))
+	assert.False(Can(RoleViewer, FlagPin))
+
+	assert.True(Can(RoleMember, CompletePin))
+	assert.False(Can(RoleMember, CompleteAnyPin))
+	assert.False(Can(RoleMember, ReopenAnyPin))
+	assert.True(Can(RoleMember, AssignPin))
+	assert.False(Can(RoleMember, AssignAnyPin))
+	assert.True(Can(RoleMember, MovePin))
+	assert.False(Can(RoleMember, MoveAnyPin))
+	assert.True(Can(RoleMember, FlagPin))
+
+	assert.True(Can(RoleModerator, DeleteAnyComment))
+	assert.True(Can(RoleModerator, ManageLabels))
+	assert.False(Can(RoleModerator, UpdateRole))
+	assert.False(Can(RoleModerator, ExportPins))
+
+	assert.True(Can(RoleAdmin, UpdateRole))
+	assert.False(Can(RoleAdmin, UpdateOwnerRole))
+	assert.True(Can(RoleAdmin, ExportPins))
+	assert.True(Can(RoleAdmin, ReadEmails))
+	assert.False(Can(RoleModerator, ReadEmails))
+
+	assert.True(Can(RoleOwner, UpdateOwnerRole))
+
+	assert.False(Can("", ReadPins))
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/brantem/aloy/constant"
 	"github.com/brantem/aloy/db"
 	"github.com/brantem/aloy/handler"
+	"github.com/brantem/aloy/health"
+	"github.com/brantem/aloy/metrics"
 	"github.com/brantem/aloy/middleware"
+	"github.com/brantem/aloy/notifier"
 	"github.com/brantem/aloy/storage"
+	"github.com/brantem/aloy/tracing"
 	"github.com/brantem/aloy/util"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
@@ -33,49 +38,99 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
+	// export can write to stdout, so its logs go to stderr
+	isExport := len(os.Args) > 1 && os.Args[1] == "export"
+	logOut := os.Stdout
+	if isExport {
+		logOut = os.Stderr
+	}
+
 	isDebug := os.Getenv("DEBUG") == "1"
 	if isDebug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout}).With().Caller().Logger()
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: logOut}).With().Caller().Logger()
+	}
+
+	if isExport {
+		if err := runExport(ctx, os.Args[2:]); err != nil {
+			log.Fatal().Err(err).Msg("export")
+		}
+		return
 	}
 
-	db := db.New()
+	shutdownTracing := tracing.New(ctx)
+
+	db := db.New(os.Stdout)
 	storage := storage.New(ctx)
 
-	app := fiber.New(fiber.Config{
-		AppName:               constant.AppID,
-		DisableStartupMessage: os.Getenv("APP_ENV") == "production",
+	if n := notifier.New(db); n != nil {
+		go n.Run(ctx)
+	}
+
+	// The IP used by the rate limits is read from PROXY_HEADER, but only for
+	// requests coming from TRUSTED_PROXIES so clients can't pick their own
+	proxyHeader := os.Getenv("PROXY_HEADER")
+	trustedProxies := strings.FieldsFunc(os.Getenv("TRUSTED_PROXIES"), func(r rune) bool {
+		return r == ',' || r == ' '
 	})
+	if proxyHeader != "" && len(trustedProxies) == 0 {
+		log.Fatal().Msg("PROXY_HEADER requires TRUSTED_PROXIES")
+	}
 
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.Status(fiber.StatusOK).Send([]byte("ok"))
+	app := fiber.New(fiber.Config{
+		AppName:                 constant.AppID,
+		DisableStartupMessage:   os.Getenv("APP_ENV") == "production",
+		ProxyHeader:             proxyHeader,
+		EnableTrustedProxyCheck: proxyHeader != "",
+		TrustedProxies:          trustedProxies,
+		EnableIPValidation:      true,
 	})
 
+	health := health.New(db, storage)
+	health.Register(app)
+
 	app.Hooks().OnShutdown(func() error {
 		db.Close()
-		return nil
+		return shutdownTracing(context.Background())
 	})
 
-	app.Use(pprof.New())
+	// pprof, metrics and the probes are served on ADMIN_ADDR when it's set.
+	// Otherwise they are mounted on the public listener only if ADMIN_TOKEN is
+	// set, since /readyz writes to the database.
+	var admin *fiber.App
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	if adminAddr != "" {
+		admin = fiber.New(fiber.Config{
+			AppName:               constant.AppID,
+			DisableStartupMessage: true,
+		})
+	} else if os.Getenv("ADMIN_TOKEN") != "" {
+		admin = app
+	}
 
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:  util.Getenv("ALLOW_ORIGINS", "*"),
-		AllowHeaders:  "Content-Type, Aloy-App-ID, Aloy-User-ID",
-		ExposeHeaders: "X-Total-Count",
-	}))
-	app.Use(compress.New(compress.Config{
-		Level: compress.LevelBestSpeed,
-	}))
-	app.Use(etag.New())
-	app.Use(helmet.New())
-	app.Use(recover.New(recover.Config{
-		EnableStackTrace: isDebug,
-	}))
-	app.Use(logger.New())
+	if admin != nil {
+		auth := middleware.Admin(os.Getenv("ADMIN_TOKEN"))
+		admin.Use("/debug/pprof", auth, pprof.New())
+		admin.Get("/metrics", auth, metrics.Handler())
+		admin.Use("/livez", auth)
+		admin.Use("/readyz", auth)
+		health.RegisterProbes(admin)
+	}
+
+	// Routes have to be registered before listening
+	if adminAddr != "" {
+		go func() {
+			if err := admin.Listen(adminAddr); err != nil {
+				log.Fatal().Err(err).Send()
+			}
+		}()
+	}
+
+	use(app, isDebug)
 
 	h := handler.New(db, storage)
-	h.Register(app, middleware.New())
+	h.Register(app, middleware.New(db))
 
 	go func() {
 		if err := app.Listen(":" + os.Getenv("PORT")); err != nil {
@@ -86,5 +141,38 @@ func main() {
 	<-ctx.Done()
 	stop()
 	app.Shutdown()
+	if admin != nil && admin != app {
+		admin.Shutdown()
+	}
 
 }
+
+// use adds the middlewares of the public routes to app
+func use(app *fiber.App, isDebug bool) {
+	app.Use(tracing.Middleware)
+	app.Use(metrics.Middleware)
+
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:  util.Getenv("ALLOW_ORIGINS", "*"),
+		AllowHeaders:  "Content-Type, Aloy-App-ID, Aloy-User-ID, traceparent, tracestate",
+		ExposeHeaders: "X-Total-Count, Retry-After",
+	}))
+
+	// Both read the whole body, which would buffer the streamed export and turn
+	// a failure halfway into a complete response
+	streamed := func(c *fiber.Ctx) bool {
+		return c.Path() == "/v1/export"
+	}
+	app.Use(tracing.Measure("compress"), compress.New(compress.Config{
+		Next:  streamed,
+		Level: compress.LevelBestSpeed,
+	}), tracing.Mark("compress"))
+	app.Use(etag.New(etag.Config{
+		Next: streamed,
+	}))
+	app.Use(helmet.New())
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace: isDebug,
+	}))
+	app.Use(logger.New())
+}
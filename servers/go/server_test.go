@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_use(t *testing.T) {
+	assert := assert.New(t)
+
+	app := fiber.New()
+	use(app, false)
+	app.Get("/v1/export", func(c *fiber.Ctx) error {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte("["))
+			pw.CloseWithError(errors.New("a"))
+		}()
+		c.Context().SetBodyStream(pr, -1)
+		return nil
+	})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("a")
+	})
+
+	t.Run("export", func(t *testing.T) {
+		req := httptest.NewRequest(fiber.MethodGet, "/v1/export", nil)
+		req.Header.Set(fiber.HeaderAcceptEncoding, "gzip")
+		// Still streamed, so the failure aborts the response
+		_, err := app.Test(req)
+		assert.EqualError(err, "a")
+	})
+
+	t.Run("other", func(t *testing.T) {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		resp, _ := app.Test(req)
+		assert.Equal(fiber.StatusOK, resp.StatusCode)
+		assert.NotEmpty(resp.Header.Get(fiber.HeaderETag))
+	})
+}
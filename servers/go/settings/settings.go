@@ -0,0 +1,164 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/model"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrInvalidTransition = errs.NewCodeError("INVALID_TRANSITION")
+
+func Default() *model.Settings {
+	return &model.Settings{
+		Statuses: []*model.Status{
+			{Key: "open", Name: "Open"},
+			{Key: "in_progress", Name: "In progress"},
+			{Key: "needs_info", Name: "Needs info"},
+			{Key: "resolved", Name: "Resolved", Closed: true},
+			{Key: "wont_fix", Name: "Won't fix", Closed: true},
+		},
+		Transitions: map[string][]string{
+			"open":        {"in_progress", "needs_info", "resolved", "wont_fix"},
+			"in_progress": {"open", "needs_info", "resolved", "wont_fix"},
+			"needs_info":  {"open", "in_progress", "resolved", "wont_fix"},
+			"resolved":    {"open"},
+			"wont_fix":    {"open"},
+		},
+		Paths:       &model.PathRules{Rewrites: []*model.PathRewrite{}},
+		Versions:    &model.VersionRules{CarryOpen: true},
+		Breakpoints: []int{},
+	}
+}
+
+// Transitions allows moving between any two of the statuses, for when the
+// statuses are replaced without transitions.
+func Transitions(statuses []*model.Status) map[string][]string {
+	m := make(map[string][]string, len(statuses))
+	for _, from := range statuses {
+		to := []string{}
+		for _, status := range statuses {
+			if status.Key != from.Key {
+				to = append(to, status.Key)
+			}
+		}
+		m[from.Key] = to
+	}
+	return m
+}
+
+// Get returns the settings of an app, falling back to the defaults for anything
+// the app hasn't configured.
+func Get(ctx context.Context, db sqlx.QueryerContext, appID string) (*model.Settings, error) {
+	var raw string
+	err := db.QueryRowxContext(ctx, `SELECT settings FROM apps WHERE id = ?`, appID).Scan(&raw)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Default(), nil
+		}
+		log.Error().Err(err).Msg("settings.Get")
+		return nil, errs.ErrInternalServerError
+	}
+
+	var settings model.Settings
+	if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+		log.Error().Err(err).Msg("settings.Get")
+		return nil, errs.ErrInternalServerError
+	}
+
+	// Unmarshaling into the defaults would merge maps and reuse slice elements
+	Fill(&settings, Default())
+
+	if err := settings.Paths.Compile(); err != nil {
+		log.Error().Err(err).Msg("settings.Get")
+		return nil, errs.ErrInternalServerError
+	}
+
+	return &settings, nil
+}
+
+// Fill copies every field that is missing in dst from src.
+func Fill(dst, src *model.Settings) {
+	v, w := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := range v.NumField() {
+		if v.Field(i).IsZero() {
+			v.Field(i).Set(w.Field(i))
+		}
+	}
+}
+
+func Save(ctx context.Context, db sqlx.ExecerContext, appID string, settings *model.Settings) error {
+	buf, _ := json.Marshal(settings)
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO apps (id, settings)
+		VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET settings = EXCLUDED.settings
+	`, appID, string(buf))
+	if err != nil {
+		log.Error().Err(err).Msg("settings.Save")
+		return errs.ErrInternalServerError
+	}
+	return nil
+}
+
+// Validate checks what the struct tags can't, the keys are used as the field
+// names in the returned errs.MapErrors.
+func Validate(settings *model.Settings) error {
+	me := make(errs.MapErrors)
+
+	keys := make(map[string]bool, len(settings.Statuses))
+	var hasOpen, hasClosed bool
+	for i, status := range settings.Statuses {
+		if keys[status.Key] {
+			me[fmt.Sprintf("statuses.%d.key", i)] = errs.ErrInvalid
+		}
+		keys[status.Key] = true
+
+		if status.Closed {
+			hasClosed = true
+		} else {
+			hasOpen = true
+		}
+	}
+	if !hasOpen || !hasClosed {
+		me["statuses"] = errs.ErrInvalid
+	}
+
+	for from, to := range settings.Transitions {
+		if !keys[from] {
+			me["transitions."+from] = errs.ErrInvalid
+			continue
+		}
+		for i, key := range to {
+			if !keys[key] {
+				me[fmt.Sprintf("transitions.%s.%d", from, i)] = errs.ErrInvalid
+			}
+		}
+	}
+
+	for i, w := range settings.Breakpoints {
+		if w <= 0 || (i > 0 && w <= settings.Breakpoints[i-1]) {
+			me[fmt.Sprintf("breakpoints.%d", i)] = errs.ErrInvalid
+		}
+	}
+
+	if settings.Paths != nil {
+		for i, rewrite := range settings.Paths.Rewrites {
+			if _, err := regexp.Compile(rewrite.Pattern); err != nil {
+				me[fmt.Sprintf("paths.rewrites.%d.pattern", i)] = errs.ErrInvalid
+			}
+		}
+	}
+
+	if len(me) != 0 {
+		return me
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package settings
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/model"
+	"github.com/brantem/aloy/testutil/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("default", func(t *testing.T) {
+		db, mock := db.New()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs("test").
+			WillReturnRows(&sqlmock.Rows{})
+
+		settings, err := Get(context.TODO(), db, "test")
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Nil(err)
+		assert.Equal(Default(), settings)
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		db, mock := db.New()
+
+		mock.ExpectQuery("SELECT settings FROM apps").
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows([]string{"settings"}).AddRow(`{"transitions":{"open":["resolved"]}}`))
+
+		settings, err := Get(context.TODO(), db, "test")
+		assert.Nil(mock.ExpectationsWereMet())
+		assert.Nil(err)
+		assert.Equal(Default().Statuses, settings.Statuses)
+		assert.Equal(map[string][]string{"open": {"resolved"}}, settings.Transitions)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(Validate(Default()))
+
+	err := Validate(&model.Settings{
+		Statuses: []*model.Status{
+			{Key: "open", Name: "Open"},
+			{Key: "open", Name: "Open"},
+		},
+		Transitions: map[string][]string{
+			"open":   {"closed"},
+			"closed": {"open"},
+		},
+		Paths: &model.PathRules{
+			Rewrites: []*model.PathRewrite{{Pattern: "^/products/[0-9]+$"}, {Pattern: "(unclosed"}},
+		},
+		Breakpoints: []int{640, 0, 1024, 768},
+	})
+	assert.Equal(errs.MapErrors{
+		"statuses.1.key":           errs.ErrInvalid,
+		"statuses":                 errs.ErrInvalid,
+		"transitions.open.0":       errs.ErrInvalid,
+		"transitions.closed":       errs.ErrInvalid,
+		"paths.rewrites.1.pattern": errs.ErrInvalid,
+		"breakpoints.1":            errs.ErrInvalid,
+		"breakpoints.3":            errs.ErrInvalid,
+	}, err)
+}
+
+func TestTransitions(t *testing.T) {
+	assert.Equal(t, map[string][]string{"a": {"b", "c"}, "b": {"a", "c"}, "c": {"a", "b"}}, Transitions([]*model.Status{{Key: "a"}, {Key: "b"}, {Key: "c", Closed: true}}))
+}
+
+func TestSettings_CanTransition(t *testing.T) {
+	assert := assert.New(t)
+
+	s := Default()
+	assert.True(s.CanTransition("open", "open"))
+	assert.True(s.CanTransition("open", "resolved"))
+	assert.False(s.CanTransition("resolved", "wont_fix"))
+	assert.True(s.CanTransition("removed", "resolved"))
+}
+
+func TestPathRules_Normalize(t *testing.T) {
+	assert := assert.New(t)
+
+	var r *model.PathRules
+	assert.Equal("/About/", r.Normalize("/About/"))
+
+	assert.Equal("/About/", Default().Paths.Normalize("/About/"))
+
+	r = &model.PathRules{
+		Lowercase:         true,
+		TrimTrailingSlash: true,
+		Rewrites: []*model.PathRewrite{
+			{Pattern: "^/(en|de)(/|$)", Replacement: "/"},
+			{Pattern: "^/products/[^/]+", Replacement: "/products/:id"},
+		},
+	}
+	assert.Equal("/about", r.Normalize("/About/"))
+	assert.Equal("/", r.Normalize("/en/"))
+	assert.Equal("/products/:id", r.Normalize("/de/products/123"))
+	assert.Equal("/products/:id/reviews", r.Normalize("/products/abc/reviews/"))
+
+	// Compiled rules normalize the same way
+	assert.Nil(r.Compile())
+	assert.Equal("/products/:id", r.Normalize("/de/products/123"))
+
+	r.Rewrites = append(r.Rewrites, &model.PathRewrite{Pattern: "(unclosed"})
+	assert.NotNil(r.Compile())
+}
+
+func TestSettings_Breakpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	s := Default()
+	_, _, ok := s.Breakpoint(1080)
+	assert.False(ok)
+
+	s.Breakpoints = []int{640, 768, 1024}
+	for w, want := range map[float64][2]float64{
+		320:  {0, 640},
+		640:  {0, 640},
+		641:  {640, 768},
+		768:  {640, 768},
+		1080: {1024, 0},
+	} {
+		start, end, ok := s.Breakpoint(w)
+		assert.True(ok)
+		assert.Equal(want, [2]float64{start, end}, w)
+	}
+}
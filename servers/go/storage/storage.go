@@ -12,6 +12,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/brantem/aloy/constant"
 	"github.com/brantem/aloy/errs"
+	"github.com/brantem/aloy/metrics"
+	"github.com/brantem/aloy/tracing"
 	"github.com/brantem/aloy/util"
 	"github.com/rs/zerolog/log"
 )
@@ -19,6 +21,7 @@ import (
 type StorageInterface interface {
 	Upload(ctx context.Context, opts *UploadOpts) error
 	DeleteMultiple(ctx context.Context, keys []string) error
+	Ping(ctx context.Context) error
 }
 
 type Storage struct {
@@ -55,6 +58,9 @@ type UploadOpts struct {
 }
 
 func (s *Storage) Upload(ctx context.Context, opts *UploadOpts) error {
+	ctx, span := tracing.Start(ctx, "storage.Upload")
+	defer span.End()
+
 	if opts.CacheControl == "" {
 		opts.CacheControl = "max-age=31536000"
 	}
@@ -67,7 +73,12 @@ func (s *Storage) Upload(ctx context.Context, opts *UploadOpts) error {
 		CacheControl:  aws.String(opts.CacheControl),
 		ContentLength: aws.Int64(opts.ContentLength),
 	}
-	if _, err := s.client.PutObject(ctx, input); err != nil {
+	err := metrics.Storage("upload", func() error {
+		_, err := s.client.PutObject(ctx, input)
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
 		log.Error().Err(err).Msg("storage.Upload")
 		return errs.ErrInternalServerError
 	}
@@ -76,6 +87,9 @@ func (s *Storage) Upload(ctx context.Context, opts *UploadOpts) error {
 }
 
 func (s *Storage) DeleteMultiple(ctx context.Context, keys []string) error {
+	ctx, span := tracing.Start(ctx, "storage.DeleteMultiple")
+	defer span.End()
+
 	objects := make([]types.ObjectIdentifier, len(keys))
 	for i, key := range keys {
 		objects[i] = types.ObjectIdentifier{
@@ -91,10 +105,32 @@ func (s *Storage) DeleteMultiple(ctx context.Context, keys []string) error {
 		},
 	}
 
-	if _, err := s.client.DeleteObjects(ctx, input); err != nil {
+	err := metrics.Storage("delete", func() error {
+		_, err := s.client.DeleteObjects(ctx, input)
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
 		log.Error().Err(err).Msg("storage.DeleteMultiple")
 		return errs.ErrInternalServerError
 	}
 
 	return nil
 }
+
+func (s *Storage) Ping(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "storage.Ping")
+	defer span.End()
+
+	err := metrics.Storage("ping", func() error {
+		_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
+		return err
+	})
+	if err != nil {
+		tracing.Error(span, err)
+		log.Error().Err(err).Msg("storage.Ping")
+		return errs.ErrInternalServerError
+	}
+
+	return nil
+}
@@ -1,6 +1,11 @@
 package db
 
 import (
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"testing"
+
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
@@ -10,3 +15,37 @@ func New() (*sqlx.DB, sqlmock.Sqlmock) {
 	v, mock, _ := sqlmock.New()
 	return sqlx.NewDb(v, "sqlmock"), mock
 }
+
+// Capture matches any argument and keeps it, for values that are only known
+// after the request, like keys generated by the handler.
+type Capture struct {
+	Value driver.Value
+}
+
+func (a *Capture) Match(v driver.Value) bool {
+	a.Value = v
+	return true
+}
+
+// NewSQLite returns an in-memory database with every migration in dir applied,
+// for tests that depend on which rows a query returns rather than its arguments.
+func NewSQLite(t testing.TB, dir string) *sqlx.DB {
+	db := sqlx.MustOpen("sqlite3", ":memory:?_foreign_keys=on")
+	// Every connection would get its own empty database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.MustExec(string(b))
+	}
+
+	return db
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"github.com/brantem/aloy/constant"
+	"github.com/brantem/aloy/middleware"
 	"github.com/brantem/aloy/testutil"
 	"github.com/gofiber/fiber/v2"
 )
@@ -9,12 +10,14 @@ import (
 type Middleware struct {
 	AppIDValue  *string
 	UserIDValue *string
+	RoleValue   *string
 }
 
 func New() *Middleware {
 	return &Middleware{
 		AppIDValue:  testutil.Ptr("test"),
 		UserIDValue: testutil.Ptr("user-1"),
+		RoleValue:   testutil.Ptr("member"),
 	}
 }
 
@@ -29,5 +32,14 @@ func (m *Middleware) User(c *fiber.Ctx) error {
 	if m.UserIDValue != nil {
 		c.Locals(constant.UserIDKey, *m.UserIDValue)
 	}
+	if m.RoleValue != nil {
+		c.Locals(constant.RoleKey, *m.RoleValue)
+	}
 	return c.Next()
 }
+
+func (m *Middleware) Limit(bucket middleware.Bucket) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.Next()
+	}
+}
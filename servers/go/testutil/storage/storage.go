@@ -15,6 +15,8 @@ type Storage struct {
 	DeleteMultipleN     int
 	DeleteMultipleKeys  [][]string
 	DeleteMultipleError []error
+
+	PingError error
 }
 
 func New() *Storage {
@@ -40,3 +42,7 @@ func (s *Storage) DeleteMultiple(ctx context.Context, keys []string) error {
 	s.DeleteMultipleN += 1
 	return err
 }
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.PingError
+}
@@ -0,0 +1,66 @@
+// Package text reads the Slate documents the widget stores as comment text.
+package text
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+type node struct {
+	Type     string `json:"type"`
+	UserID   int    `json:"user_id"`
+	Text     string `json:"text"`
+	Children []node `json:"children"`
+}
+
+func parse(s string) []node {
+	var nodes []node
+	if err := json.Unmarshal([]byte(s), &nodes); err != nil {
+		return nil
+	}
+	return nodes
+}
+
+func walk(nodes []node, fn func(n *node)) {
+	for i := range nodes {
+		fn(&nodes[i])
+		walk(nodes[i].Children, fn)
+	}
+}
+
+// Mentions returns the ids of the users mentioned with a
+// {"type":"mention","user_id":1} element, without duplicates.
+func Mentions(s string) []int {
+	var ids []int
+	walk(parse(s), func(n *node) {
+		if n.Type == "mention" && n.UserID != 0 && !slices.Contains(ids, n.UserID) {
+			ids = append(ids, n.UserID)
+		}
+	})
+	return ids
+}
+
+// Plain returns the text of every leaf with one line per block, mentions are
+// written as @name using names. Text that isn't a Slate document is returned
+// as is.
+func Plain(s string, names map[int]string) string {
+	nodes := parse(s)
+	if nodes == nil {
+		return s
+	}
+
+	lines := make([]string, len(nodes))
+	for i := range nodes {
+		var b strings.Builder
+		walk(nodes[i].Children, func(n *node) {
+			if n.Type == "mention" {
+				b.WriteString("@" + names[n.UserID])
+			} else {
+				b.WriteString(n.Text)
+			}
+		})
+		lines[i] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,35 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMentions(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(Mentions("Test"))
+	assert.Nil(Mentions(`[{"type":"paragraph","children":[{"text":"Test"}]}]`))
+	assert.Equal([]int{2, 1}, Mentions(`[
+		{"type":"paragraph","children":[
+			{"text":"Hi "},
+			{"type":"mention","user_id":2,"children":[{"text":""}]},
+			{"type":"mention","user_id":1,"children":[{"text":""}]},
+			{"type":"mention","user_id":2,"children":[{"text":""}]}
+		]}
+	]`))
+}
+
+func TestPlain(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("Test", Plain("Test", nil))
+	assert.Equal("Hi @User 2\nbye", Plain(`[
+		{"type":"paragraph","children":[
+			{"text":"Hi "},
+			{"type":"mention","user_id":2,"children":[{"text":""}]}
+		]},
+		{"type":"paragraph","children":[{"text":"bye","bold":true}]}
+	]`, map[int]string{2: "User 2"}))
+}
@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/brantem/aloy/constant"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New installs an OTLP exporter when OTEL_EXPORTER_OTLP_ENDPOINT is set, the
+// remaining OTEL_* variables are read by the exporter itself. Without it the
+// global no-op tracer stays in place.
+func New(ctx context.Context) func(context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("tracing.New")
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(constant.AppID))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown
+}
+
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(constant.AppID).Start(ctx, name, opts...)
+}
+
+func Error(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Middleware starts a span for every request and stores it in the user context,
+// handlers must pass c.UserContext() down for child spans to be attached.
+func Middleware(c *fiber.Ctx) error {
+	header := make(http.Header)
+	c.Request().Header.VisitAll(func(k, v []byte) {
+		header.Add(string(k), string(v))
+	})
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), propagation.HeaderCarrier(header))
+
+	ctx, span := Start(ctx, c.Method(), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(c.Method()),
+		semconv.URLPath(c.Path()),
+	))
+	defer span.End()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if e, ok := err.(*fiber.Error); ok {
+		status = e.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+
+	route := c.Route().Path
+	span.SetName(c.Method() + " " + route)
+	span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+
+	return err
+}
+
+// Measure and Mark wrap a middleware that does its work after the rest of the
+// stack has returned, like compress, so that work gets its own span:
+//
+//	app.Use(tracing.Measure("compress"), compress.New(), tracing.Mark("compress"))
+func Measure(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		if t, ok := c.Locals(markKey(name)).(time.Time); ok {
+			_, span := Start(c.UserContext(), name, trace.WithTimestamp(t))
+			span.End()
+		}
+
+		return err
+	}
+}
+
+func Mark(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		c.Locals(markKey(name), time.Now())
+		return err
+	}
+}
+
+func markKey(name string) string {
+	return "tracing." + name
+}
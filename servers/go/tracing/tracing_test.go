@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brantem/aloy/testutil/tracing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Run("success", func(t *testing.T) {
+		exporter := tracing.New()
+
+		app := fiber.New()
+		app.Use(Middleware)
+		app.Get("/pins/:pinId<int>", func(c *fiber.Ctx) error {
+			_, span := Start(c.UserContext(), "child")
+			span.End()
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		req := httptest.NewRequest(fiber.MethodGet, "/pins/1", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		app.Test(req)
+
+		spans := exporter.GetSpans()
+		assert.Len(spans, 2)
+		assert.Equal("child", spans[0].Name)
+		assert.Equal(spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+		assert.Equal("GET /pins/:pinId<int>", spans[1].Name)
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", spans[1].SpanContext.TraceID().String())
+		assert.Contains(spans[1].Attributes, semconv.HTTPRoute("/pins/:pinId<int>"))
+		assert.Contains(spans[1].Attributes, semconv.HTTPResponseStatusCode(fiber.StatusOK))
+		assert.Equal(codes.Unset, spans[1].Status.Code)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		exporter := tracing.New()
+
+		app := fiber.New()
+		app.Use(Middleware)
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		})
+
+		app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+
+		spans := exporter.GetSpans()
+		assert.Len(spans, 1)
+		assert.Equal(codes.Error, spans[0].Status.Code)
+	})
+}
+
+func TestMeasure(t *testing.T) {
+	assert := assert.New(t)
+
+	exporter := tracing.New()
+
+	app := fiber.New()
+	app.Use(Middleware)
+	app.Use(Measure("compress"), Mark("compress"))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+
+	spans := exporter.GetSpans()
+	assert.Len(spans, 2)
+	assert.Equal("compress", spans[0].Name)
+	assert.Equal(spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+}
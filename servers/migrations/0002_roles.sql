@@ -0,0 +1,6 @@
+-- Migration number: 0002 	 2026-10-19T09:12:41.318Z
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+
+UPDATE users
+SET role = 'owner'
+WHERE id IN (SELECT MIN(id) FROM users GROUP BY app_id);
@@ -0,0 +1,22 @@
+-- Migration number: 0003 	 2026-10-19T10:04:27.551Z
+CREATE TABLE apps (
+  id TEXT PRIMARY KEY,
+  settings TEXT NOT NULL DEFAULT '{}'
+);
+
+ALTER TABLE pins ADD COLUMN status TEXT NOT NULL DEFAULT 'open';
+
+UPDATE pins
+SET status = 'resolved'
+WHERE completed_at IS NOT NULL;
+
+CREATE TABLE pin_statuses (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  pin_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  from_status TEXT NOT NULL,
+  to_status TEXT NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (pin_id) REFERENCES pins(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- Migration number: 0004 	 2026-10-19T11:26:08.193Z
+CREATE TABLE pin_assignees (
+  pin_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  assigned_by_id INTEGER NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (pin_id, user_id),
+  FOREIGN KEY (pin_id) REFERENCES pins(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (assigned_by_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX pin_assignees_user_id ON pin_assignees (user_id);
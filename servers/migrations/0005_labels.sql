@@ -0,0 +1,19 @@
+-- Migration number: 0005 	 2026-10-19T12:03:51.642Z
+CREATE TABLE labels (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  app_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  color TEXT NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (app_id, name)
+);
+
+CREATE TABLE pin_labels (
+  pin_id INTEGER NOT NULL,
+  label_id INTEGER NOT NULL,
+  PRIMARY KEY (pin_id, label_id),
+  FOREIGN KEY (pin_id) REFERENCES pins(id) ON DELETE CASCADE,
+  FOREIGN KEY (label_id) REFERENCES labels(id) ON DELETE CASCADE
+);
+
+CREATE INDEX pin_labels_label_id ON pin_labels (label_id);
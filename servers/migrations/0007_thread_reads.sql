@@ -0,0 +1,12 @@
+-- Migration number: 0007 	 2026-10-19T13:15:44.270Z
+CREATE TABLE thread_reads (
+  user_id INTEGER NOT NULL,
+  pin_id INTEGER NOT NULL,
+  comment_id INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, pin_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (pin_id) REFERENCES pins(id) ON DELETE CASCADE
+);
+
+CREATE INDEX comments_pin_id ON comments (pin_id, id);
@@ -0,0 +1,16 @@
+-- Migration number: 0008 	 2026-10-19T13:52:09.381Z
+CREATE TABLE pin_subscriptions (
+  pin_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (pin_id, user_id),
+  FOREIGN KEY (pin_id) REFERENCES pins(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX pin_subscriptions_user_id ON pin_subscriptions (user_id);
+
+INSERT INTO pin_subscriptions (pin_id, user_id)
+SELECT DISTINCT pin_id, user_id
+FROM comments
+WHERE pin_id IS NOT NULL;
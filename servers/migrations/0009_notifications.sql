@@ -0,0 +1,21 @@
+-- Migration number: 0009 	 2026-10-19T14:36:22.518Z
+ALTER TABLE users ADD COLUMN email TEXT;
+ALTER TABLE users ADD COLUMN notifications TEXT NOT NULL DEFAULT 'instant';
+
+CREATE TABLE notifications (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  pin_id INTEGER NOT NULL,
+  actor_id INTEGER NOT NULL,
+  comment_id INTEGER,
+  type TEXT NOT NULL,
+  data TEXT,
+  created_at INTEGER NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  sent_at INTEGER,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (pin_id) REFERENCES pins(id) ON DELETE CASCADE,
+  FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_unsent ON notifications (user_id) WHERE sent_at IS NULL;
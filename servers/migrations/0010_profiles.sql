@@ -0,0 +1,3 @@
+-- Migration number: 0010 	 2026-10-19T15:08:47.731Z
+ALTER TABLE users ADD COLUMN avatar_url TEXT;
+ALTER TABLE users ADD COLUMN metadata TEXT;
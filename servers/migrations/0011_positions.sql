@@ -0,0 +1,18 @@
+-- Migration number: 0011 	 2026-10-19T16:21:05.318Z
+ALTER TABLE pins ADD COLUMN detached_at INTEGER;
+
+CREATE TABLE pin_positions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  pin_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  _path TEXT NOT NULL,
+  path TEXT NOT NULL,
+  w REAL NOT NULL,
+  _x REAL NOT NULL,
+  x REAL NOT NULL,
+  _y REAL NOT NULL,
+  y REAL NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (pin_id) REFERENCES pins(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
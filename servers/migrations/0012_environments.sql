@@ -0,0 +1,3 @@
+-- Migration number: 0012 	 2026-10-19T17:02:41.906Z
+ALTER TABLE pins ADD COLUMN environment TEXT;
+ALTER TABLE pins ADD COLUMN version TEXT;
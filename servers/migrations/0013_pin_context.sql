@@ -0,0 +1,2 @@
+-- Migration number: 0013 	 2026-10-19T17:40:12.275Z
+ALTER TABLE pins ADD COLUMN context TEXT;
@@ -0,0 +1,2 @@
+-- Migration number: 0014 	 2026-10-19T18:15:37.640Z
+ALTER TABLE pins ADD COLUMN screenshot TEXT;
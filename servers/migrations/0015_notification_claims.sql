@@ -0,0 +1,9 @@
+-- Migration number: 0015 	 2026-10-20T09:12:48.305Z
+ALTER TABLE notifications ADD COLUMN claimed_at INTEGER;
+ALTER TABLE notifications ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE notification_digests (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  due_at INTEGER NOT NULL UNIQUE,
+  created_at INTEGER NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -169,7 +169,7 @@ def complete_pin(
             db.execute(
                 """
                     UPDATE pins
-                    SET completed_at = CURRENT_TIMESTAMP, completed_by_id = ?
+                    SET status = 'resolved', completed_at = CURRENT_TIMESTAMP, completed_by_id = ?
                     WHERE id = ?
                       AND completed_at IS NULL
                 """,
@@ -179,7 +179,7 @@ def complete_pin(
             db.execute(
                 """
                     UPDATE pins
-                    SET completed_at = NULL, completed_by_id = NULL
+                    SET status = 'open', completed_at = NULL, completed_by_id = NULL
                     WHERE id = ?
                       AND completed_at IS NOT NULL
                 """,
@@ -178,8 +178,8 @@ def test_create_pin(client: TestClient, db: sqlite3.Connection, storage: Storage
 
 
 def test_complete_pin(client: TestClient, db: sqlite3.Connection):
-    pin = db.execute("SELECT completed_at, completed_by_id FROM pins WHERE id = 1").fetchone()
-    assert dict(pin) == {"completed_at": None, "completed_by_id": None}
+    pin = db.execute("SELECT status, completed_at, completed_by_id FROM pins WHERE id = 1").fetchone()
+    assert dict(pin) == {"status": "open", "completed_at": None, "completed_by_id": None}
 
     # complete
     headers = {"Content-Type": "text/plain", "Aloy-App-ID": "test", "Aloy-User-ID": "1"}
@@ -187,7 +187,8 @@ def test_complete_pin(client: TestClient, db: sqlite3.Connection):
     assert response.status_code == status.HTTP_200_OK
     assert response.json() == {"success": True, "error": None}
 
-    pin = db.execute("SELECT completed_at, completed_by_id FROM pins WHERE id = 1").fetchone()
+    pin = db.execute("SELECT status, completed_at, completed_by_id FROM pins WHERE id = 1").fetchone()
+    assert pin["status"] == "resolved"
     assert pin["completed_at"] is not None
     assert pin["completed_by_id"] == 1
 
@@ -197,8 +198,8 @@ def test_complete_pin(client: TestClient, db: sqlite3.Connection):
     assert response.status_code == status.HTTP_200_OK
     assert response.json() == {"success": True, "error": None}
 
-    pin = db.execute("SELECT completed_at, completed_by_id FROM pins WHERE id = 1").fetchone()
-    assert dict(pin) == {"completed_at": None, "completed_by_id": None}
+    pin = db.execute("SELECT status, completed_at, completed_by_id FROM pins WHERE id = 1").fetchone()
+    assert dict(pin) == {"status": "open", "completed_at": None, "completed_by_id": None}
 
 
 def test_delete_pin(client: TestClient, db: sqlite3.Connection):